@@ -17,9 +17,10 @@ func legacyArgs(cmd *Command, args []string) error {
 		return nil
 	}
 
-	// root command with subcommands, do subcommand checking.
-	if !cmd.HasParent() && len(args) > 0 {
-		return fmt.Errorf("unknown command %q for %q%s", args[0], cmd.CommandPath(), cmd.findSuggestions(args[0]))
+	// root command, or command only grouping subcommands, with subcommands:
+	// do subcommand checking.
+	if (!cmd.HasParent() || !cmd.Runnable()) && len(args) > 0 {
+		return &unknownCommandError{fmt.Sprintf("unknown command %q for %q%s", args[0], cmd.CommandPath(), cmd.findSuggestions(args[0]))}
 	}
 	return nil
 }
@@ -27,7 +28,7 @@ func legacyArgs(cmd *Command, args []string) error {
 // NoArgs returns an error if any args are included.
 func NoArgs(cmd *Command, args []string) error {
 	if len(args) > 0 {
-		return fmt.Errorf("unknown command %q for %q", args[0], cmd.CommandPath())
+		return &unknownCommandError{fmt.Sprintf("unknown command %q for %q", args[0], cmd.CommandPath())}
 	}
 	return nil
 }
@@ -1,13 +1,15 @@
 package cobra
 
 import (
-	"bytes"
+	"bufio"
 	"fmt"
 	"io"
 	"os"
 	"sort"
 	"strings"
+	"unicode"
 
+	"github.com/spf13/cobra/internal/flagspec"
 	"github.com/spf13/pflag"
 )
 
@@ -17,9 +19,10 @@ const (
 	BashCompCustom          = "cobra_annotation_bash_completion_custom"
 	BashCompOneRequiredFlag = "cobra_annotation_bash_completion_one_required_flag"
 	BashCompSubdirsInDir    = "cobra_annotation_bash_completion_subdirs_in_dir"
+	BashCompValidValues     = "cobra_annotation_bash_completion_valid_values"
 )
 
-func writePreamble(buf *bytes.Buffer, name string) {
+func writePreamble(buf io.StringWriter, name string) {
 	buf.WriteString(fmt.Sprintf("# bash completion for %-36s -*- shell-script -*-\n", name))
 	buf.WriteString(fmt.Sprintf(`
 __%[1]s_debug()
@@ -380,7 +383,7 @@ __%[1]s_handle_word()
 		ShellCompDirectiveFilterFileExt, ShellCompDirectiveFilterDirs))
 }
 
-func writePostscript(buf *bytes.Buffer, name string) {
+func writePostscript(buf io.StringWriter, name string) {
 	name = strings.Replace(name, ":", "__", -1)
 	buf.WriteString(fmt.Sprintf("__start_%s()\n", name))
 	buf.WriteString(fmt.Sprintf(`{
@@ -420,7 +423,7 @@ fi
 	buf.WriteString("# ex: ts=4 sw=4 et filetype=sh\n")
 }
 
-func writeCommands(buf *bytes.Buffer, cmd *Command) {
+func writeCommands(buf io.StringWriter, cmd *Command) {
 	buf.WriteString("    commands=()\n")
 	for _, c := range cmd.Commands() {
 		if !c.IsAvailableCommand() && c != cmd.helpCommand {
@@ -432,7 +435,7 @@ func writeCommands(buf *bytes.Buffer, cmd *Command) {
 	buf.WriteString("\n")
 }
 
-func writeFlagHandler(buf *bytes.Buffer, name string, annotations map[string][]string, cmd *Command) {
+func writeFlagHandler(buf io.StringWriter, name string, annotations map[string][]string, cmd *Command) {
 	for key, value := range annotations {
 		switch key {
 		case BashCompFilenameExt:
@@ -467,10 +470,10 @@ func writeFlagHandler(buf *bytes.Buffer, name string, annotations map[string][]s
 	}
 }
 
-func writeShortFlag(buf *bytes.Buffer, flag *pflag.Flag, cmd *Command) {
+func writeShortFlag(buf io.StringWriter, flag *pflag.Flag, cmd *Command) {
 	name := flag.Shorthand
 	format := "    "
-	if len(flag.NoOptDefVal) == 0 {
+	if takesArg, _ := flagspec.ValueSpec(flag); takesArg {
 		format += "two_word_"
 	}
 	format += "flags+=(\"-%s\")\n"
@@ -478,25 +481,26 @@ func writeShortFlag(buf *bytes.Buffer, flag *pflag.Flag, cmd *Command) {
 	writeFlagHandler(buf, "-"+name, flag.Annotations, cmd)
 }
 
-func writeFlag(buf *bytes.Buffer, flag *pflag.Flag, cmd *Command) {
+func writeFlag(buf io.StringWriter, flag *pflag.Flag, cmd *Command) {
 	name := flag.Name
+	takesArg, _ := flagspec.ValueSpec(flag)
 	format := "    flags+=(\"--%s"
-	if len(flag.NoOptDefVal) == 0 {
+	if takesArg {
 		format += "="
 	}
 	format += "\")\n"
 	buf.WriteString(fmt.Sprintf(format, name))
-	if len(flag.NoOptDefVal) == 0 {
+	if takesArg {
 		format = "    two_word_flags+=(\"--%s\")\n"
 		buf.WriteString(fmt.Sprintf(format, name))
 	}
 	writeFlagHandler(buf, "--"+name, flag.Annotations, cmd)
 }
 
-func writeLocalNonPersistentFlag(buf *bytes.Buffer, flag *pflag.Flag) {
+func writeLocalNonPersistentFlag(buf io.StringWriter, flag *pflag.Flag) {
 	name := flag.Name
 	format := "    local_nonpersistent_flags+=(\"--%[1]s\")\n"
-	if len(flag.NoOptDefVal) == 0 {
+	if takesArg, _ := flagspec.ValueSpec(flag); takesArg {
 		format += "    local_nonpersistent_flags+=(\"--%[1]s=\")\n"
 	}
 	buf.WriteString(fmt.Sprintf(format, name))
@@ -517,9 +521,22 @@ func prepareCustomAnnotationsForFlags(cmd *Command) {
 		}
 		flag.Annotations[BashCompCustom] = []string{fmt.Sprintf("__%[1]s_handle_go_custom_completion", cmd.Root().Name())}
 	}
+	// Do the same for flags completed by a function registered for their name,
+	// by their valid values and for enum flags
+	prepareDefault := func(flag *pflag.Flag) {
+		if cmd.flagCompletionFunc(flag) == nil {
+			return
+		}
+		if flag.Annotations == nil {
+			flag.Annotations = map[string][]string{}
+		}
+		flag.Annotations[BashCompCustom] = []string{fmt.Sprintf("__%[1]s_handle_go_custom_completion", cmd.Root().Name())}
+	}
+	cmd.NonInheritedFlags().VisitAll(prepareDefault)
+	cmd.InheritedFlags().VisitAll(prepareDefault)
 }
 
-func writeFlags(buf *bytes.Buffer, cmd *Command) {
+func writeFlags(buf io.StringWriter, cmd *Command) {
 	prepareCustomAnnotationsForFlags(cmd)
 	buf.WriteString(`    flags=()
     two_word_flags=()
@@ -556,7 +573,7 @@ func writeFlags(buf *bytes.Buffer, cmd *Command) {
 	buf.WriteString("\n")
 }
 
-func writeRequiredFlag(buf *bytes.Buffer, cmd *Command) {
+func writeRequiredFlag(buf io.StringWriter, cmd *Command) {
 	buf.WriteString("    must_have_one_flag=()\n")
 	flags := cmd.NonInheritedFlags()
 	flags.VisitAll(func(flag *pflag.Flag) {
@@ -567,7 +584,7 @@ func writeRequiredFlag(buf *bytes.Buffer, cmd *Command) {
 			switch key {
 			case BashCompOneRequiredFlag:
 				format := "    must_have_one_flag+=(\"--%s"
-				if flag.Value.Type() != "bool" {
+				if takesArg, _ := flagspec.ValueSpec(flag); takesArg {
 					format += "="
 				}
 				format += "\")\n"
@@ -581,21 +598,22 @@ func writeRequiredFlag(buf *bytes.Buffer, cmd *Command) {
 	})
 }
 
-func writeRequiredNouns(buf *bytes.Buffer, cmd *Command) {
+func writeRequiredNouns(buf io.StringWriter, cmd *Command) {
 	buf.WriteString("    must_have_one_noun=()\n")
-	sort.Sort(sort.StringSlice(cmd.ValidArgs))
-	for _, value := range cmd.ValidArgs {
+	validArgs := append([]string{}, cmd.ValidArgs...)
+	sort.Strings(validArgs)
+	for _, value := range validArgs {
 		// Remove any description that may be included following a tab character.
 		// Descriptions are not supported by bash completion.
 		value = strings.Split(value, "\t")[0]
-		buf.WriteString(fmt.Sprintf("    must_have_one_noun+=(%q)\n", value))
+		buf.WriteString(fmt.Sprintf("    must_have_one_noun+=(%s)\n", bashQuote(value)))
 	}
 	if cmd.ValidArgsFunction != nil {
 		buf.WriteString("    has_completion_function=1\n")
 	}
 }
 
-func writeCmdAliases(buf *bytes.Buffer, cmd *Command) {
+func writeCmdAliases(buf io.StringWriter, cmd *Command) {
 	if len(cmd.Aliases) == 0 {
 		return
 	}
@@ -610,7 +628,7 @@ func writeCmdAliases(buf *bytes.Buffer, cmd *Command) {
 	buf.WriteString(`    fi`)
 	buf.WriteString("\n")
 }
-func writeArgAliases(buf *bytes.Buffer, cmd *Command) {
+func writeArgAliases(buf io.StringWriter, cmd *Command) {
 	buf.WriteString("    noun_aliases=()\n")
 	sort.Sort(sort.StringSlice(cmd.ArgAliases))
 	for _, value := range cmd.ArgAliases {
@@ -618,7 +636,7 @@ func writeArgAliases(buf *bytes.Buffer, cmd *Command) {
 	}
 }
 
-func gen(buf *bytes.Buffer, cmd *Command) {
+func gen(buf io.StringWriter, cmd *Command) {
 	for _, c := range cmd.Commands() {
 		if !c.IsAvailableCommand() && c != cmd.helpCommand {
 			continue
@@ -650,7 +668,9 @@ func gen(buf *bytes.Buffer, cmd *Command) {
 
 // GenBashCompletion generates bash completion file and writes to the passed writer.
 func (c *Command) GenBashCompletion(w io.Writer) error {
-	buf := new(bytes.Buffer)
+	// The script is written as the command tree is walked, which keeps memory
+	// usage low for large trees.
+	buf := bufio.NewWriter(w)
 	writePreamble(buf, c.Name())
 	if len(c.BashCompletionFunction) > 0 {
 		buf.WriteString(c.BashCompletionFunction + "\n")
@@ -658,8 +678,16 @@ func (c *Command) GenBashCompletion(w io.Writer) error {
 	gen(buf, c)
 	writePostscript(buf, c.Name())
 
-	_, err := buf.WriteTo(w)
-	return err
+	return buf.Flush()
+}
+
+// bashQuote quotes s so that bash reads it back verbatim. Double quotes are
+// used unless s contains characters bash would still interpret within them.
+func bashQuote(s string) string {
+	if strings.ContainsAny(s, "$`\\") || strings.IndexFunc(s, func(r rune) bool { return !unicode.IsPrint(r) }) >= 0 {
+		return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+	}
+	return fmt.Sprintf("%q", s)
 }
 
 func nonCompletableFlag(flag *pflag.Flag) bool {
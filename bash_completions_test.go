@@ -8,6 +8,8 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+
+	"github.com/spf13/pflag"
 )
 
 func checkOmit(t *testing.T, found, unexpected string) {
@@ -260,3 +262,155 @@ func TestBashCompletionTraverseChildren(t *testing.T) {
 	checkOmit(t, output, `local_nonpersistent_flags+=("--bool-flag")`)
 	checkOmit(t, output, `local_nonpersistent_flags+=("-b")`)
 }
+
+func TestBashCompletionValidArgs(t *testing.T) {
+	c := &Command{
+		Use:       "c",
+		ValidArgs: []string{"stop", "start\tStart the service", "$HOME", "it's"},
+		Run:       emptyRun,
+	}
+
+	buf := new(bytes.Buffer)
+	c.GenBashCompletion(buf)
+	output := buf.String()
+
+	check(t, output, `must_have_one_noun+=("start")`)
+	check(t, output, `must_have_one_noun+=("stop")`)
+	check(t, output, `must_have_one_noun+=('$HOME')`)
+	check(t, output, `must_have_one_noun+=("it's")`)
+
+	if c.ValidArgs[0] != "stop" {
+		t.Errorf("Expected ValidArgs to be left unsorted, got %v", c.ValidArgs)
+	}
+}
+
+func TestBashCompletionLatePersistentFlag(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.SetGlobalNormalizationFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		return pflag.NormalizedName(strings.Replace(name, "_", "-", -1))
+	})
+	child := &Command{Use: "child", Run: emptyRun}
+	root.AddCommand(child)
+
+	// Generate once so that the flag sets of child are merged before the
+	// persistent flag is added to root.
+	root.GenBashCompletion(new(bytes.Buffer))
+
+	root.PersistentFlags().String("late_flag", "", "added after child")
+
+	buf := new(bytes.Buffer)
+	root.GenBashCompletion(buf)
+	output := buf.String()
+
+	start := strings.Index(output, "_root_child()")
+	end := strings.Index(output, "_root_root_command()")
+	if start < 0 || end < start {
+		t.Fatalf("Expected a completion function for child, got:\n%s", output)
+	}
+	check(t, output[start:end], `flags+=("--late-flag=")`)
+	checkOmit(t, output, "late_flag")
+
+	output, err := executeCommand(root, ShellCompNoDescRequestCmd, "child", "--l")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	check(t, output, "--late-flag\n")
+}
+
+func TestBashCompletionInheritedFlagsAtEveryLevel(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().String("config", "", "config file")
+	sub1 := &Command{Use: "sub1", Run: emptyRun}
+	sub1.PersistentFlags().Bool("dry-run", false, "")
+	sub2 := &Command{Use: "sub2", Run: emptyRun}
+	sub3 := &Command{Use: "sub3", Run: emptyRun}
+	sub2.AddCommand(sub3)
+	sub1.AddCommand(sub2)
+	root.AddCommand(sub1)
+
+	buf := new(bytes.Buffer)
+	if err := root.GenBashCompletion(buf); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+
+	for _, fn := range []string{"_root_sub1()", "_root_sub1_sub2()", "_root_sub1_sub2_sub3()"} {
+		start := strings.Index(output, fn)
+		if start < 0 {
+			t.Fatalf("Expected a completion function %s, got:\n%s", fn, output)
+		}
+		end := start + strings.Index(output[start:], "\n}\n")
+		check(t, output[start:end], `flags+=("--config=")`)
+	}
+	start := strings.Index(output, "_root_sub1_sub2_sub3()")
+	end := start + strings.Index(output[start:], "\n}\n")
+	check(t, output[start:end], `flags+=("--dry-run")`)
+
+	// Zsh, fish and powershell complete flags through the __complete command
+	output, err := executeCommand(root, ShellCompNoDescRequestCmd, "sub1", "sub2", "sub3", "--")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	check(t, output, "--config\n")
+	check(t, output, "--dry-run\n")
+}
+
+func TestBashCompletionEnumFlag(t *testing.T) {
+	var format string
+	root := &Command{Use: "root", Run: emptyRun}
+	EnumVar(root.Flags(), &format, "format", []string{"json", "yaml", "table"}, "table", "output format")
+
+	buf := new(bytes.Buffer)
+	if err := root.GenBashCompletion(buf); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+
+	// The values of the enum flag are completed by the Go completion logic,
+	// which offers the allowed values and no file names.
+	check(t, output, `flags_with_completion+=("--format")`)
+	check(t, output, `flags_completion+=("__root_handle_go_custom_completion")`)
+	checkOmit(t, output, `flags_completion+=("_filedir")`)
+
+	output, err := executeCommand(root, ShellCompNoDescRequestCmd, "--format", "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	check(t, output, "json\nyaml\ntable\n:4\n")
+}
+
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestBashCompletionStreaming(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	for i := 0; i < 100; i++ {
+		child := &Command{Use: fmt.Sprintf("child%d", i), Run: emptyRun}
+		child.Flags().String("flag", "", "")
+		root.AddCommand(child)
+	}
+
+	w := new(countingWriter)
+	if err := root.GenBashCompletion(w); err != nil {
+		t.Fatal(err)
+	}
+	if w.writes < 2 {
+		t.Errorf("Expected the script to be written in several parts, got %d writes", w.writes)
+	}
+
+	// The streamed script is the same as the one generated in memory.
+	buf := new(bytes.Buffer)
+	writePreamble(buf, root.Name())
+	gen(buf, root)
+	writePostscript(buf, root.Name())
+	if w.String() != buf.String() {
+		t.Error("Expected the streamed script to match the one generated in memory")
+	}
+}
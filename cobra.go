@@ -19,12 +19,14 @@ package cobra
 import (
 	"fmt"
 	"io"
+	"io/ioutil"
 	"reflect"
 	"strconv"
 	"strings"
 	"text/template"
 	"time"
 	"unicode"
+	"unicode/utf8"
 )
 
 var templateFuncs = template.FuncMap{
@@ -33,8 +35,12 @@ var templateFuncs = template.FuncMap{
 	"trimTrailingWhitespaces": trimRightSpace,
 	"appendIfNotPresent":      appendIfNotPresent,
 	"rpad":                    rpad,
+	"indentExample":           indentExample,
 	"gt":                      Gt,
 	"eq":                      Eq,
+	"bold":                    plain,
+	"cyan":                    plain,
+	"cyanFlags":               plain,
 }
 
 var initializers []func()
@@ -48,6 +54,12 @@ var EnablePrefixMatching = false
 // To disable sorting, set it to false.
 var EnableCommandSorting = true
 
+// EnableFlagShorthandValidation makes Execute check every command of the tree
+// with ValidateFlagShorthands before running anything, so that colliding flag
+// shorthands are reported as an error instead of a panic.
+// Set this to true to enable it.
+var EnableFlagShorthandValidation = false
+
 // MousetrapHelpText enables an information splash screen on Windows
 // if the CLI is started from explorer.exe.
 // To disable the mousetrap, just set this variable to blank string ("").
@@ -147,16 +159,60 @@ func appendIfNotPresent(s, stringToAppend string) string {
 	return s + " " + stringToAppend
 }
 
-// rpad adds padding to the right of a string.
+// indentExample trims the blank lines around example, removes the leading
+// whitespace common to its non-empty lines, and indents them by two spaces.
+// The lines indented further, such as continuation lines, keep their offset.
+func indentExample(example string) string {
+	lines := strings.Split(example, "\n")
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	prefix, first := "", true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			prefix, first = indent, false
+			continue
+		}
+		for !strings.HasPrefix(indent, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if line != "" {
+			line = "  " + strings.TrimPrefix(line, prefix)
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rpad adds padding to the right of a string, up to a visible width which
+// does not count ANSI escape sequences.
 func rpad(s string, padding int) string {
-	template := fmt.Sprintf("%%-%ds", padding)
-	return fmt.Sprintf(template, s)
+	width := utf8.RuneCountInString(stripANSI(s))
+	if width >= padding {
+		return s
+	}
+	return s + strings.Repeat(" ", padding-width)
 }
 
 // tmpl executes the given template text on data, writing the result to w.
-func tmpl(w io.Writer, text string, data interface{}) error {
+func tmpl(w io.Writer, text string, data interface{}, funcs ...template.FuncMap) error {
 	t := template.New("top")
 	t.Funcs(templateFuncs)
+	for _, f := range funcs {
+		t.Funcs(f)
+	}
 	template.Must(t.Parse(text))
 	return t.Execute(w, data)
 }
@@ -197,6 +253,14 @@ func ld(s, t string, ignoreCase bool) int {
 	return d[len(s)][len(t)]
 }
 
+// copyStrings returns a copy of s, or nil if s is nil.
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
+
 func stringInSlice(a string, list []string) bool {
 	for _, b := range list {
 		if b == a {
@@ -205,3 +269,89 @@ func stringInSlice(a string, list []string) bool {
 	}
 	return false
 }
+
+// splitArgs splits line into arguments the way a POSIX shell would split
+// words. Single quotes preserve their content literally, double quotes
+// preserve their content except for backslash escapes, and a backslash
+// outside of quotes escapes the character that follows it. An empty line gives
+// an empty, non-nil slice.
+func splitArgs(line string) ([]string, error) {
+	args := []string{}
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\') {
+				i++
+				arg.WriteRune(runes[i])
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("trailing backslash in %q", line)
+			}
+			i++
+			arg.WriteRune(runes[i])
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, line)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// expandArgFiles replaces each argument of args starting with '@' with the
+// arguments read from the file it names, split as by splitArgs. An argument
+// starting with "@@" is kept, less its first '@'.
+func expandArgFiles(args []string) ([]string, error) {
+	var expanded []string
+	for _, arg := range args {
+		switch {
+		case strings.HasPrefix(arg, "@@"):
+			expanded = append(expanded, arg[1:])
+		case strings.HasPrefix(arg, "@") && len(arg) > 1:
+			content, err := ioutil.ReadFile(arg[1:])
+			if err != nil {
+				return nil, fmt.Errorf("cannot read arguments from %q: %v", arg[1:], err)
+			}
+			fileArgs, err := splitArgs(string(content))
+			if err != nil {
+				return nil, fmt.Errorf("cannot read arguments from %q: %v", arg[1:], err)
+			}
+			expanded = append(expanded, fileArgs...)
+		default:
+			expanded = append(expanded, arg)
+		}
+	}
+	return expanded, nil
+}
@@ -1,6 +1,7 @@
 package cobra
 
 import (
+	"reflect"
 	"testing"
 	"text/template"
 )
@@ -20,3 +21,39 @@ func TestAddTemplateFunctions(t *testing.T) {
 		t.Errorf("Expected UsageString: %v\nGot: %v", expected, got)
 	}
 }
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{``, []string{}},
+		{"  \t ", []string{}},
+		{`  get   pods  `, []string{"get", "pods"}},
+		{`echo "hello world"`, []string{"echo", "hello world"}},
+		{`echo 'hello world'`, []string{"echo", "hello world"}},
+		{`echo "say \"hi\""`, []string{"echo", `say "hi"`}},
+		{`echo 'a \"b\"'`, []string{"echo", `a \"b\"`}},
+		{`echo hello\ world`, []string{"echo", "hello world"}},
+		{`--name="" x`, []string{"--name=", "x"}},
+	}
+
+	for _, tc := range tests {
+		got, err := splitArgs(tc.line)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", tc.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("Expected %q to split into %q, got %q", tc.line, tc.expected, got)
+		}
+	}
+}
+
+func TestSplitArgsUnterminatedQuote(t *testing.T) {
+	for _, line := range []string{`echo "hello`, `echo 'hello`, `echo hello\`} {
+		if _, err := splitArgs(line); err == nil {
+			t.Errorf("Expected an error for %q", line)
+		}
+	}
+}
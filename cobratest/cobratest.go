@@ -0,0 +1,26 @@
+// Package cobratest provides helpers to test cobra applications.
+package cobratest
+
+import (
+	"bytes"
+
+	"github.com/spf13/cobra"
+)
+
+// CaptureExecute executes root with the given args and returns everything
+// written to its output and error output, along with the error of the
+// execution.
+func CaptureExecute(root *cobra.Command, args ...string) (output string, err error) {
+	buf := new(bytes.Buffer)
+	root.SetOut(buf)
+	root.SetErr(buf)
+	// Never fall back to os.Args
+	if args == nil {
+		args = []string{}
+	}
+	root.SetArgs(args)
+
+	err = root.Execute()
+
+	return buf.String(), err
+}
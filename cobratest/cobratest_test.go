@@ -0,0 +1,46 @@
+package cobratest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCaptureExecute(t *testing.T) {
+	root := &cobra.Command{
+		Use: "root",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Println("hello", strings.Join(args, " "))
+			cmd.PrintErrln("warning")
+		},
+	}
+
+	output, err := CaptureExecute(root, "a", "b")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if expected := "hello a b\nwarning\n"; output != expected {
+		t.Errorf("Expected %q, got %q", expected, output)
+	}
+}
+
+func TestCaptureExecuteError(t *testing.T) {
+	runErr := errors.New("failure")
+	root := &cobra.Command{
+		Use:  "root",
+		RunE: func(*cobra.Command, []string) error { return runErr },
+	}
+
+	output, err := CaptureExecute(root)
+	if err != runErr {
+		t.Errorf("Expected error %v, got %v", runErr, err)
+	}
+	if !strings.Contains(output, "Error: failure\n") {
+		t.Errorf("Expected the error in the output, got %q", output)
+	}
+	if !strings.Contains(output, "Usage:\n  root [flags]") {
+		t.Errorf("Expected the usage in the output, got %q", output)
+	}
+}
@@ -0,0 +1,91 @@
+package cobra
+
+import (
+	"io"
+	"os"
+	"regexp"
+	"text/template"
+)
+
+// flagNamesRx matches the names at the start of each line of flag usages.
+var flagNamesRx = regexp.MustCompile(`(?m)^(\s+)((?:-\S, )?--\S+)`)
+
+// ansiRx matches the ANSI escape sequences setting colors and styles.
+var ansiRx = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// colorTemplateFuncs replace the plain "bold", "cyan" and "cyanFlags"
+// template functions when the output of help and usage is colored.
+var colorTemplateFuncs = template.FuncMap{
+	"bold":      bold,
+	"cyan":      cyan,
+	"cyanFlags": cyanFlags,
+}
+
+func bold(s string) string {
+	return "\x1b[1m" + s + "\x1b[0m"
+}
+
+func cyan(s string) string {
+	return "\x1b[36m" + s + "\x1b[0m"
+}
+
+// cyanFlags colors the flag names in the output of FlagUsages.
+func cyanFlags(usages string) string {
+	return flagNamesRx.ReplaceAllStringFunc(usages, func(m string) string {
+		sub := flagNamesRx.FindStringSubmatch(m)
+		return sub[1] + cyan(sub[2])
+	})
+}
+
+// stripANSI removes the ANSI escape sequences from s.
+func stripANSI(s string) string {
+	return ansiRx.ReplaceAllString(s, "")
+}
+
+// plain returns s unchanged. It is the default "bold", "cyan" and "cyanFlags"
+// template function.
+func plain(s string) string {
+	return s
+}
+
+// SetColor enables or disables colored help and usage output for the command
+// and its children. By default, output is colored only when it is written to
+// a terminal and the NO_COLOR environment variable is not set.
+func (c *Command) SetColor(enabled bool) {
+	c.color = &enabled
+}
+
+// colorEnabled reports whether help and usage written to w by c are colored.
+func (c *Command) colorEnabled(w io.Writer) bool {
+	for p := c; p != nil; p = p.Parent() {
+		if p.color != nil {
+			return *p.color
+		}
+	}
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	return isTerminal(w)
+}
+
+// colorFuncs returns the template functions coloring the output written to w
+// by c, if any.
+func (c *Command) colorFuncs(w io.Writer) template.FuncMap {
+	if c.colorEnabled(w) {
+		return colorTemplateFuncs
+	}
+	return nil
+}
+
+// isTerminal reports whether w is a character device such as a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,83 @@
+package cobra
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestColoredHelp(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.Flags().String("format", "", "output format")
+	childCmd := &Command{Use: "child", Short: "child command", Run: emptyRun}
+	root.AddCommand(childCmd)
+	root.SetColor(true)
+
+	output, err := executeCommand(root, "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "\x1b[1mUsage:\x1b[0m")
+	checkStringContains(t, output, "\x1b[1mAvailable Commands:\x1b[0m")
+	checkStringContains(t, output, "\x1b[36mchild      \x1b[0m child command")
+	checkStringContains(t, output, "      \x1b[36m--format\x1b[0m string   output format")
+	checkStringContains(t, output, "  \x1b[36m-h, --help\x1b[0m ")
+}
+
+func TestColoredPaddingAlignment(t *testing.T) {
+	if got := rpad(cyan("ab"), 5); got != cyan("ab")+"   " {
+		t.Errorf("Expected padding to the visible width, got %q", got)
+	}
+
+	root := &Command{Use: "root", Run: emptyRun}
+	root.AddCommand(&Command{Use: "a", Short: "first", Run: emptyRun})
+	root.AddCommand(&Command{Use: "longer", Short: "second", Run: emptyRun})
+	root.SetColor(true)
+	// Color the names before padding them
+	root.SetUsageTemplate(`{{range .Commands}}{{if .IsAvailableCommand}}{{rpad (cyan .Name) .NamePadding}} {{.Short}}
+{{end}}{{end}}`)
+
+	output, err := executeCommand(root, "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "\x1b[36ma\x1b[0m")
+	lines := strings.Split(strings.TrimSpace(stripANSI(output)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %q", lines)
+	}
+	if strings.Index(lines[0], "first") != strings.Index(lines[1], "second") {
+		t.Errorf("Expected the columns to line up, got:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestPlainHelp(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.Flags().String("format", "", "output format")
+	childCmd := &Command{Use: "child", Short: "child command", Run: emptyRun}
+	root.AddCommand(childCmd)
+
+	// Output which is not a terminal is not colored by default.
+	output, err := executeCommand(root, "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringOmits(t, output, "\x1b[")
+
+	root.SetColor(false)
+	output, err = executeCommand(root, "child", "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringOmits(t, output, "\x1b[")
+}
+
+func TestColorDisabledByNoColor(t *testing.T) {
+	os.Setenv("NO_COLOR", "1")
+	defer os.Unsetenv("NO_COLOR")
+
+	root := &Command{Use: "root", Run: emptyRun}
+	if root.colorEnabled(os.Stdout) {
+		t.Error("Expected colors to be disabled when NO_COLOR is set")
+	}
+}
@@ -18,19 +18,37 @@ package cobra
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"text/template"
 
+	"github.com/spf13/cobra/internal/flagspec"
 	flag "github.com/spf13/pflag"
 )
 
 // FParseErrWhitelist configures Flag parse errors to be ignored
 type FParseErrWhitelist flag.ParseErrorsWhitelist
 
+// ValidationMode defines how many errors are reported when the arguments and
+// flags of a command fail validation.
+type ValidationMode int
+
+const (
+	// FirstError reports only the first validation error found. This is the default.
+	FirstError ValidationMode = iota + 1
+	// AllErrors reports all the validation errors found, joined with newlines
+	// in an error which errors.Is and errors.As match against each of them.
+	// In this mode, required flags and flag groups are validated together with the
+	// arguments, before any of the *PreRun functions are called.
+	AllErrors
+)
+
 // Command is just that, a command for your application.
 // E.g.  'go run ...' - 'run' is the command. Cobra requires
 // you to define the usage and description as part of your command
@@ -61,6 +79,8 @@ type Command struct {
 	Long string
 
 	// Example is examples of how to use the command.
+	// With SetExampleTemplating, it is rendered as a template with the command
+	// as data, so that it can refer to the program as {{.ProgramName}}.
 	Example string
 
 	// ValidArgs is list of all valid non-flag arguments that are accepted in bash completions
@@ -104,6 +124,11 @@ type Command struct {
 	//   * PostRun()
 	//   * PersistentPostRun()
 	// All functions get the same args, the arguments after the command name.
+	// They are run once the flags are parsed and the args and flags are
+	// validated by Args and the required flags and flag groups.
+	// If one of the *RunE functions returns an error, the execution stops and
+	// the error is returned: none of the following functions are run, not even
+	// PersistentPostRun.
 	//
 	// PersistentPreRun: children of this command will inherit and execute.
 	PersistentPreRun func(cmd *Command, args []string)
@@ -136,6 +161,14 @@ type Command struct {
 	// If this is true all flags will be passed to the command as arguments.
 	DisableFlagParsing bool
 
+	// DisableHelpFlag disables the help flag added by default to the command,
+	// so that the command can define its own or, with DisableFlagParsing,
+	// receive --help as an argument. The rest of the tree keeps its help flag.
+	// When the flags are parsed and the command defines no flag of that name,
+	// --help and -h still show the help of the command, as pflag reports them
+	// as requests for help, but the help flag is not listed in the usage.
+	DisableHelpFlag bool
+
 	// DisableAutoGenTag defines, if gen tag ("Auto generated by spf13/cobra...")
 	// will be printed by generating docs for this command.
 	DisableAutoGenTag bool
@@ -179,6 +212,13 @@ type Command struct {
 	args []string
 	// flagErrorBuf contains all error messages from pflag.
 	flagErrorBuf *bytes.Buffer
+	// unknownFlags are the unknown flags skipped by the last parsing.
+	unknownFlags []string
+	// flagStates are the states of the flags of the tree before they were
+	// first parsed, kept by the root command to reset the flags.
+	flagStates map[*flag.Flag]*flagState
+	// flagsMu guards the lazy initialization of flags and pflags.
+	flagsMu sync.Mutex
 	// flags is full set of flags.
 	flags *flag.FlagSet
 	// pflags contains persistent flags.
@@ -197,9 +237,26 @@ type Command struct {
 	usageFunc func(*Command) error
 	// usageTemplate is usage template defined by user.
 	usageTemplate string
+	// useLine is the use line defined by user, overriding the computed one.
+	useLine string
+	// flagGroupingFunc is func defined by user and it's called to render the
+	// flag sections of the usage.
+	flagGroupingFunc func(*flag.FlagSet) string
+	// flagGroups are the titled groups of flags shown in separate sections of
+	// the usage.
+	flagGroups []flagGroup
+	// flagConstraints are the flag groups, such as mutually exclusive flags,
+	// checked when the command is executed.
+	flagConstraints []flagConstraint
 	// flagErrorFunc is func defined by user and it's called when the parsing of
 	// flags returns an error.
 	flagErrorFunc func(*Command, error) error
+	// exitCodeFunc is func defined by user and it's called to map the error of
+	// the execution to the exit code of ExecuteAndExit.
+	exitCodeFunc func(error) int
+	// errorHook is func defined by user and it's called when the command
+	// cannot be found or its flags or arguments are invalid.
+	errorHook func(cmd *Command, args []string, err error)
 	// helpTemplate is help template defined by user.
 	helpTemplate string
 	// helpFunc is help func defined by user.
@@ -209,6 +266,31 @@ type Command struct {
 	helpCommand *Command
 	// versionTemplate is the version template defined by user.
 	versionTemplate string
+	// helpFlagName is the name of the help flag defined by user.
+	helpFlagName string
+	// helpFlagShorthand is the shorthand of the help flag defined by user.
+	helpFlagShorthand *string
+	// prefixMatching is the prefix matching setting defined by user.
+	prefixMatching *bool
+	// argFileExpansion tells if arguments starting with '@' are replaced with
+	// the content of the file they name.
+	argFileExpansion bool
+	// sortFlags is the flag sorting setting defined by user.
+	sortFlags *bool
+	// errorPathPrefix is the error prefixing setting defined by user.
+	errorPathPrefix *bool
+	// exampleTemplating is the example templating setting defined by user.
+	exampleTemplating *bool
+	// nameColumnWidth is the minimum width of the command name column
+	// defined by user, or 0 for the default one.
+	nameColumnWidth int
+	// color is the colored output setting defined by user.
+	color *bool
+	// validationMode is the validation mode defined by user.
+	validationMode ValidationMode
+	// defaultFlagCompletionFuncs are the completion functions registered by
+	// flag name for this command and its children.
+	defaultFlagCompletionFuncs map[string]func(cmd *Command, args []string, toComplete string) ([]string, ShellCompDirective)
 
 	// inReader is a reader defined by the user that replaces stdin
 	inReader io.Reader
@@ -224,6 +306,13 @@ func (c *Command) Context() context.Context {
 	return c.ctx
 }
 
+// SetContext sets the context of the command. Executing the command tree
+// passes the context of the root command on to the executed child command,
+// unless the child has a context of its own.
+func (c *Command) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
 // SetArgs sets arguments for the command. It is set to os.Args[1:] by default, if desired, can be overridden
 // particularly useful when testing.
 func (c *Command) SetArgs(a []string) {
@@ -266,6 +355,34 @@ func (c *Command) SetUsageTemplate(s string) {
 	c.usageTemplate = s
 }
 
+// SetUseLine overrides the use line of the command. UseLine returns s
+// verbatim instead of computing it from the parents and Use.
+func (c *Command) SetUseLine(s string) {
+	c.useLine = s
+}
+
+// SetFlagGroupingFunc sets the function rendering the flag sections of the
+// default usage template, e.g. to group the flags into categories.
+func (c *Command) SetFlagGroupingFunc(f func(*flag.FlagSet) string) {
+	c.flagGroupingFunc = f
+}
+
+// SetExitCodeFunc sets the function mapping the error returned by the
+// execution of the command to the exit code of ExecuteAndExit. It is only
+// called for a non-nil error: a successful execution always exits with 0.
+func (c *Command) SetExitCodeFunc(f func(error) int) {
+	c.exitCodeFunc = f
+}
+
+// SetErrorHook sets a function called with the command, its arguments, and
+// the error when the execution of the command or of one of its children fails
+// because no command matches the arguments, the flags cannot be parsed, or
+// the arguments or flags are invalid. It is called before the error is
+// returned, and is meant for logging.
+func (c *Command) SetErrorHook(f func(cmd *Command, args []string, err error)) {
+	c.errorHook = f
+}
+
 // SetFlagErrorFunc sets a function to generate an error when flag parsing
 // fails.
 func (c *Command) SetFlagErrorFunc(f func(*Command, error) error) {
@@ -292,6 +409,12 @@ func (c *Command) SetVersionTemplate(s string) {
 	c.versionTemplate = s
 }
 
+// SetValidationMode sets how many errors are reported when the arguments and
+// flags of the command, or of its children, fail validation.
+func (c *Command) SetValidationMode(mode ValidationMode) {
+	c.validationMode = mode
+}
+
 // SetGlobalNormalizationFunc sets a normalization function to all flag sets and also to child commands.
 // The user should not have a cyclic dependency on commands.
 func (c *Command) SetGlobalNormalizationFunc(n func(f *flag.FlagSet, name string) flag.NormalizedName) {
@@ -354,6 +477,100 @@ func (c *Command) getIn(def io.Reader) io.Reader {
 	return def
 }
 
+// ValidationMode returns either the validation mode set by SetValidationMode
+// for this command or a parent, or FirstError.
+func (c *Command) ValidationMode() ValidationMode {
+	if c.validationMode != 0 {
+		return c.validationMode
+	}
+	if c.HasParent() {
+		return c.Parent().ValidationMode()
+	}
+	return FirstError
+}
+
+// FlagUsages renders flags with either the function set by
+// SetFlagGroupingFunc for this command or a parent, or with the flat
+// pflag FlagUsages. The usage of the flags which are mutually exclusive or
+// required together with others notes these other flags.
+func (c *Command) FlagUsages(flags *flag.FlagSet) string {
+	flags = c.withFlagGroupUsages(flags)
+	for p := c; p != nil; p = p.parent {
+		if p.flagGroupingFunc != nil {
+			return p.flagGroupingFunc(flags)
+		}
+	}
+	return flags.FlagUsages()
+}
+
+// flagGroup is a titled group of flags added by AddFlagGroup.
+type flagGroup struct {
+	title     string
+	flagNames []string
+}
+
+// FlagSection is a titled section of the flags shown in the usage.
+type FlagSection struct {
+	Title  string
+	Usages string
+}
+
+// AddFlagGroup groups the named flags, local or inherited, under title in the
+// usage. A flag can only belong to a single group of the command.
+func (c *Command) AddFlagGroup(title string, flagNames ...string) error {
+	c.mergePersistentFlags()
+	for _, name := range flagNames {
+		if c.Flags().Lookup(name) == nil {
+			return fmt.Errorf("no such flag -%v", name)
+		}
+		for _, group := range c.flagGroups {
+			if stringInSlice(name, group.flagNames) {
+				return fmt.Errorf("flag %q is already in the flag group %q", name, group.title)
+			}
+		}
+	}
+	c.flagGroups = append(c.flagGroups, flagGroup{title: title, flagNames: copyStrings(flagNames)})
+	return nil
+}
+
+// FlagSections splits flags into a section per group added by AddFlagGroup to
+// this command or a parent, followed by a section with the given title for the
+// remaining flags. Sections without available flags are omitted.
+func (c *Command) FlagSections(flags *flag.FlagSet, title string) []FlagSection {
+	var sections []FlagSection
+	grouped := map[string]bool{}
+	for p := c; p != nil; p = p.parent {
+		for _, group := range p.flagGroups {
+			groupFlags := flag.NewFlagSet(group.title, flag.ContinueOnError)
+			groupFlags.SortFlags = flags.SortFlags
+			for _, name := range group.flagNames {
+				if f := flags.Lookup(name); f != nil && !grouped[f.Name] {
+					grouped[f.Name] = true
+					groupFlags.AddFlag(f)
+				}
+			}
+			if groupFlags.HasAvailableFlags() {
+				sections = append(sections, FlagSection{Title: group.title, Usages: c.FlagUsages(groupFlags)})
+			}
+		}
+	}
+	if len(grouped) == 0 {
+		return []FlagSection{{Title: title, Usages: c.FlagUsages(flags)}}
+	}
+
+	rest := flag.NewFlagSet(title, flag.ContinueOnError)
+	rest.SortFlags = flags.SortFlags
+	flags.VisitAll(func(f *flag.Flag) {
+		if !grouped[f.Name] {
+			rest.AddFlag(f)
+		}
+	})
+	if rest.HasAvailableFlags() {
+		sections = append(sections, FlagSection{Title: title, Usages: c.FlagUsages(rest)})
+	}
+	return sections
+}
+
 // UsageFunc returns either the function set by SetUsageFunc for this command
 // or a parent, or it returns a default usage function.
 func (c *Command) UsageFunc() (f func(*Command) error) {
@@ -364,8 +581,7 @@ func (c *Command) UsageFunc() (f func(*Command) error) {
 		return c.Parent().UsageFunc()
 	}
 	return func(c *Command) error {
-		c.mergePersistentFlags()
-		err := tmpl(c.OutOrStderr(), c.UsageTemplate(), c)
+		err := tmpl(c.OutOrStderr(), c.UsageTemplate(), c, c.colorFuncs(c.OutOrStderr()))
 		if err != nil {
 			c.PrintErrln(err)
 		}
@@ -390,10 +606,9 @@ func (c *Command) HelpFunc() func(*Command, []string) {
 		return c.Parent().HelpFunc()
 	}
 	return func(c *Command, a []string) {
-		c.mergePersistentFlags()
 		// The help should be sent to stdout
 		// See https://github.com/spf13/cobra/issues/1002
-		err := tmpl(c.OutOrStdout(), c.HelpTemplate(), c)
+		err := tmpl(c.OutOrStdout(), c.HelpTemplate(), c, c.colorFuncs(c.OutOrStdout()))
 		if err != nil {
 			c.PrintErrln(err)
 		}
@@ -408,11 +623,26 @@ func (c *Command) Help() error {
 	return nil
 }
 
+// SetHelpAsDefaultRun makes c print its help when it is invoked directly.
+// This is useful for commands which only group subcommands.
+// It does nothing if c already defines Run or RunE.
+func (c *Command) SetHelpAsDefaultRun() {
+	if c.Runnable() {
+		return
+	}
+	c.Run = func(cmd *Command, args []string) {
+		cmd.Help()
+	}
+}
+
 // UsageString returns usage string.
 func (c *Command) UsageString() string {
-	// Storing normal writers
+	// Storing normal writers, and keeping the colors of the output
 	tmpOutput := c.outWriter
 	tmpErr := c.errWriter
+	tmpColor := c.color
+	color := c.colorEnabled(c.OutOrStdout())
+	c.color = &color
 
 	bb := new(bytes.Buffer)
 	c.outWriter = bb
@@ -423,6 +653,7 @@ func (c *Command) UsageString() string {
 	// Setting things back to normal
 	c.outWriter = tmpOutput
 	c.errWriter = tmpErr
+	c.color = tmpColor
 
 	return bb.String()
 }
@@ -443,6 +674,37 @@ func (c *Command) FlagErrorFunc() (f func(*Command, error) error) {
 	}
 }
 
+// ExitCodeFunc returns either the function set by SetExitCodeFunc for this
+// command or a parent, or it returns a function which returns 0 for a nil
+// error and 1 otherwise.
+func (c *Command) ExitCodeFunc() func(error) int {
+	if c.exitCodeFunc != nil {
+		return c.exitCodeFunc
+	}
+
+	if c.HasParent() {
+		return c.parent.ExitCodeFunc()
+	}
+	return func(err error) int {
+		if err != nil {
+			return 1
+		}
+		return 0
+	}
+}
+
+// callErrorHook calls the function set by SetErrorHook for c or a parent, if
+// any, with args and err, and returns err.
+func (c *Command) callErrorHook(args []string, err error) error {
+	for p := c; p != nil; p = p.Parent() {
+		if p.errorHook != nil {
+			p.errorHook(c, args, err)
+			break
+		}
+	}
+	return err
+}
+
 var minUsagePadding = 25
 
 // UsagePadding return padding for the usage.
@@ -467,12 +729,37 @@ var minNamePadding = 11
 
 // NamePadding returns padding for the name.
 func (c *Command) NamePadding() int {
-	if c.parent == nil || minNamePadding > c.parent.commandsMaxNameLen {
+	if c.parent == nil {
 		return minNamePadding
 	}
+	min := minNamePadding
+	if width := c.parent.commandColumnWidth(); width > 0 {
+		min = width
+	}
+	if min > c.parent.commandsMaxNameLen {
+		return min
+	}
 	return c.parent.commandsMaxNameLen
 }
 
+// SetCommandColumnWidth sets the minimum width of the column of command names
+// in the usage of c and its children. Longer names still widen the column.
+// Zero, the default, sizes the column from the longest name.
+func (c *Command) SetCommandColumnWidth(width int) {
+	c.nameColumnWidth = width
+}
+
+// commandColumnWidth returns the minimum width of the column of command names
+// in the usage of c, as set by SetCommandColumnWidth for c or a parent.
+func (c *Command) commandColumnWidth() int {
+	for p := c; p != nil; p = p.Parent() {
+		if p.nameColumnWidth > 0 {
+			return p.nameColumnWidth
+		}
+	}
+	return 0
+}
+
 // UsageTemplate returns usage template for the command.
 func (c *Command) UsageTemplate() string {
 	if c.usageTemplate != "" {
@@ -482,27 +769,27 @@ func (c *Command) UsageTemplate() string {
 	if c.HasParent() {
 		return c.parent.UsageTemplate()
 	}
-	return `Usage:{{if .Runnable}}
+	return `{{bold "Usage:"}}{{if .Runnable}}
   {{.UseLine}}{{end}}{{if .HasAvailableSubCommands}}
   {{.CommandPath}} [command]{{end}}{{if gt (len .Aliases) 0}}
 
-Aliases:
+{{bold "Aliases:"}}
   {{.NameAndAliases}}{{end}}{{if .HasExample}}
 
-Examples:
-{{.Example}}{{end}}{{if .HasAvailableSubCommands}}
+{{bold "Examples:"}}
+{{.RenderedExample | indentExample}}{{end}}{{if .HasAvailableSubCommands}}
 
-Available Commands:{{range .Commands}}{{if (or .IsAvailableCommand (eq .Name "help"))}}
-  {{rpad .Name .NamePadding }} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}
+{{bold "Available Commands:"}}{{range .Commands}}{{if (or .IsAvailableCommand (eq .Name "help"))}}
+  {{cyan (rpad .Name .NamePadding)}} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableLocalFlags}}{{range .FlagSections .LocalFlags "Flags"}}
 
-Flags:
-{{.LocalFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasAvailableInheritedFlags}}
+{{bold (print .Title ":")}}
+{{.Usages | trimTrailingWhitespaces | cyanFlags}}{{end}}{{end}}{{if .HasAvailableInheritedFlags}}{{range .FlagSections .InheritedFlags "Global Flags"}}
 
-Global Flags:
-{{.InheritedFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}{{if .HasHelpSubCommands}}
+{{bold (print .Title ":")}}
+{{.Usages | trimTrailingWhitespaces | cyanFlags}}{{end}}{{end}}{{if .HasHelpSubCommands}}
 
-Additional help topics:{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
-  {{rpad .CommandPath .CommandPathPadding}} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableSubCommands}}
+{{bold "Additional help topics:"}}{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
+  {{cyan (rpad .CommandPath .CommandPathPadding)}} {{.Short}}{{end}}{{end}}{{end}}{{if .HasAvailableSubCommands}}
 
 Use "{{.CommandPath}} [command] --help" for more information about a command.{{end}}
 `
@@ -615,23 +902,29 @@ func isFlagArg(arg string) bool {
 // Find the target command given the args and command tree
 // Meant to be run on the highest node. Only searches down.
 func (c *Command) Find(args []string) (*Command, []string, error) {
-	var innerfind func(*Command, []string) (*Command, []string)
+	var innerfind func(*Command, []string) (*Command, []string, error)
 
-	innerfind = func(c *Command, innerArgs []string) (*Command, []string) {
+	innerfind = func(c *Command, innerArgs []string) (*Command, []string, error) {
 		argsWOflags := stripFlags(innerArgs, c)
 		if len(argsWOflags) == 0 {
-			return c, innerArgs
+			return c, innerArgs, nil
 		}
 		nextSubCmd := argsWOflags[0]
 
-		cmd := c.findNext(nextSubCmd)
+		cmd, err := c.findNext(nextSubCmd)
+		if err != nil {
+			return c, innerArgs, err
+		}
 		if cmd != nil {
 			return innerfind(cmd, argsMinusFirstX(innerArgs, nextSubCmd))
 		}
-		return c, innerArgs
+		return c, innerArgs, nil
 	}
 
-	commandFound, a := innerfind(c, args)
+	commandFound, a, err := innerfind(c, args)
+	if err != nil {
+		return commandFound, a, err
+	}
 	if commandFound.Args == nil {
 		return commandFound, a, legacyArgs(commandFound, stripFlags(a, commandFound))
 	}
@@ -655,23 +948,162 @@ func (c *Command) findSuggestions(arg string) string {
 	return suggestionsString
 }
 
-func (c *Command) findNext(next string) *Command {
-	matches := make([]*Command, 0)
+// SetPrefixMatching enables or disables the resolution of sub commands of the
+// command and its children from an unambiguous prefix of their name or of one
+// of their aliases. It overrides EnablePrefixMatching.
+func (c *Command) SetPrefixMatching(enabled bool) {
+	c.prefixMatching = &enabled
+}
+
+// SetSortFlags sets whether the flags of the command and its children are
+// sorted by name in help, usage and documentation, which is the default, or
+// listed in the order of their declaration.
+func (c *Command) SetSortFlags(sorted bool) {
+	c.sortFlags = &sorted
+}
+
+// SetErrorPathPrefix sets whether the errors reported when parsing or
+// validating the flags and arguments of the command and its children are
+// prefixed with the path of the command, as in "app sub leaf: invalid
+// argument".
+func (c *Command) SetErrorPathPrefix(enabled bool) {
+	c.errorPathPrefix = &enabled
+}
+
+// prefixError returns err prefixed with the path of c if SetErrorPathPrefix
+// enabled it for c or a parent, and err otherwise.
+func (c *Command) prefixError(err error) error {
+	if err == nil || err == flag.ErrHelp {
+		return err
+	}
+	for p := c; p != nil; p = p.Parent() {
+		if p.errorPathPrefix != nil {
+			if *p.errorPathPrefix {
+				return &commandPathError{path: c.CommandPath(), err: err}
+			}
+			break
+		}
+	}
+	return err
+}
+
+// SetArgFileExpansion sets whether Execute replaces each argument starting
+// with '@' with the arguments read from the file it names, which are split on
+// whitespace with shell-style quoting. An argument starting with "@@" is
+// passed as is, less its first '@'. The arguments of shell completion
+// requests are not expanded. It must be set on the root command.
+func (c *Command) SetArgFileExpansion(enabled bool) {
+	c.argFileExpansion = enabled
+}
+
+// flagsSorted reports whether the flags of c are sorted by name, as set by
+// SetSortFlags for c or a parent or else by the SortFlags of c.Flags().
+func (c *Command) flagsSorted() bool {
+	for p := c; p != nil; p = p.Parent() {
+		if p.sortFlags != nil {
+			return *p.sortFlags
+		}
+	}
+	return c.Flags().SortFlags
+}
+
+// prefixMatchingEnabled reports whether the sub commands of c can be called by
+// a prefix of their name.
+func (c *Command) prefixMatchingEnabled() bool {
+	for p := c; p != nil; p = p.Parent() {
+		if p.prefixMatching != nil {
+			return *p.prefixMatching
+		}
+	}
+	return EnablePrefixMatching
+}
+
+// findNext returns the sub command of c called next. An exact match on the
+// name of a command wins over an exact match on an alias, which wins over a
+// prefix match when prefix matching is enabled. An error is returned if next
+// is the prefix of several commands.
+func (c *Command) findNext(next string) (*Command, error) {
 	for _, cmd := range c.commands {
-		if cmd.Name() == next || cmd.HasAlias(next) {
+		if cmd.Name() == next {
 			cmd.commandCalledAs.name = next
-			return cmd
+			return cmd, nil
 		}
-		if EnablePrefixMatching && cmd.hasNameOrAliasPrefix(next) {
-			matches = append(matches, cmd)
+	}
+	for _, cmd := range c.commands {
+		if cmd.HasAlias(next) {
+			cmd.commandCalledAs.name = next
+			return cmd, nil
 		}
 	}
 
+	if !c.prefixMatchingEnabled() {
+		return nil, nil
+	}
+	matches := make([]*Command, 0)
+	for _, cmd := range c.commands {
+		if cmd.hasNameOrAliasPrefix(next) {
+			matches = append(matches, cmd)
+		}
+	}
+	if len(matches) > 1 {
+		names := make([]string, 0, len(matches))
+		for _, cmd := range matches {
+			names = append(names, cmd.Name())
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("ambiguous command %q for %q, could be: %s", next, c.CommandPath(), strings.Join(names, ", "))
+	}
 	if len(matches) == 1 {
-		return matches[0]
+		return matches[0], nil
 	}
 
-	return nil
+	return nil, nil
+}
+
+// findCommand prepares args the way Execute does, expanding the argument files
+// unless args is a shell completion request and checking the flag shorthands
+// of the tree, then finds the command to run for them from the root command c.
+// It returns the command and its arguments, flags included.
+func (c *Command) findCommand(args []string) (*Command, []string, error) {
+	completing := len(args) > 0 && (args[0] == ShellCompRequestCmd || args[0] == ShellCompNoDescRequestCmd)
+	if c.argFileExpansion && !completing {
+		var err error
+		if args, err = expandArgFiles(args); err != nil {
+			return nil, nil, err
+		}
+	}
+	if EnableFlagShorthandValidation {
+		if err := c.validateFlagShorthandsTree(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if c.TraverseChildren {
+		return c.Traverse(args)
+	}
+	return c.Find(args)
+}
+
+// ResolveOnly finds the command the root command would run for args and
+// parses its flags, the same way Execute does, but without running any hook
+// or the command itself. It returns the command and its positional arguments.
+func (c *Command) ResolveOnly(args []string) (*Command, []string, error) {
+	root := c.Root()
+	root.InitDefaultHelpCmd()
+
+	cmd, flags, err := root.findCommand(args)
+	if err != nil {
+		return cmd, nil, err
+	}
+
+	if cmd.DisableFlagParsing {
+		return cmd, flags, nil
+	}
+	cmd.InitDefaultHelpFlag()
+	cmd.InitDefaultVersionFlag()
+	if err := cmd.ParseFlags(flags); err != nil {
+		return cmd, nil, err
+	}
+	return cmd, cmd.Flags().Args(), nil
 }
 
 // Traverse the command tree to find the command, and parse args for
@@ -704,7 +1136,10 @@ func (c *Command) Traverse(args []string) (*Command, []string, error) {
 			continue
 		}
 
-		cmd := c.findNext(arg)
+		cmd, err := c.findNext(arg)
+		if err != nil {
+			return c, args, err
+		}
 		if cmd == nil {
 			return c, args, nil
 		}
@@ -746,6 +1181,27 @@ func (c *Command) VisitParents(fn func(*Command)) {
 	}
 }
 
+// VisitAll invokes fn on the command and then on all its descendants, depth
+// first, visiting the children of each command in the order of Commands.
+func (c *Command) VisitAll(fn func(*Command)) {
+	fn(c)
+	for _, cmd := range c.Commands() {
+		cmd.VisitAll(fn)
+	}
+}
+
+// AllCommandPaths returns the paths of the command and of its descendants
+// which are runnable, neither hidden nor deprecated, in the order of VisitAll.
+func (c *Command) AllCommandPaths() []string {
+	var paths []string
+	c.VisitAll(func(cmd *Command) {
+		if cmd.Runnable() && !cmd.Hidden && cmd.Deprecated == "" {
+			paths = append(paths, cmd.CommandPath())
+		}
+	})
+	return paths
+}
+
 // Root finds root command.
 func (c *Command) Root() *Command {
 	if c.HasParent() {
@@ -776,21 +1232,24 @@ func (c *Command) execute(a []string) (err error) {
 
 	err = c.ParseFlags(a)
 	if err != nil {
-		return c.FlagErrorFunc()(c, err)
+		return c.callErrorHook(a, c.prefixError(c.FlagErrorFunc()(c, err)))
 	}
 
 	// If help is called, regardless of other flags, return we want help.
 	// Also say we need help if the command isn't runnable.
-	helpVal, err := c.Flags().GetBool("help")
-	if err != nil {
-		// should be impossible to get here as we always declare a help
-		// flag in InitDefaultHelpFlag()
-		c.Println("\"help\" flag declared as non-bool. Please correct your code")
-		return err
-	}
+	if !c.DisableHelpFlag {
+		helpName, _ := c.helpFlag()
+		helpVal, err := c.Flags().GetBool(helpName)
+		if err != nil {
+			// should be impossible to get here as we always declare a help
+			// flag in InitDefaultHelpFlag()
+			c.Printf("%q flag declared as non-bool. Please correct your code\n", helpName)
+			return err
+		}
 
-	if helpVal {
-		return flag.ErrHelp
+		if helpVal {
+			return flag.ErrHelp
+		}
 	}
 
 	// for back-compat, only add version flag behavior if version is defined
@@ -810,6 +1269,9 @@ func (c *Command) execute(a []string) (err error) {
 	}
 
 	if !c.Runnable() {
+		if !c.HasParent() && c.HasAvailableSubCommands() {
+			return ErrSubCommandRequired
+		}
 		return flag.ErrHelp
 	}
 
@@ -820,8 +1282,14 @@ func (c *Command) execute(a []string) (err error) {
 		argWoFlags = a
 	}
 
-	if err := c.ValidateArgs(argWoFlags); err != nil {
-		return err
+	// The arguments and the flags are validated before any hook runs, so
+	// that the hooks see valid and fully parsed arguments and flag values.
+	if err := c.validate(
+		func() error { return c.ValidateArgs(argWoFlags) },
+		c.validateRequiredFlags,
+		c.validateFlagGroups,
+	); err != nil {
+		return c.callErrorHook(a, c.prefixError(err))
 	}
 
 	for p := c; p != nil; p = p.Parent() {
@@ -843,9 +1311,6 @@ func (c *Command) execute(a []string) (err error) {
 		c.PreRun(c, argWoFlags)
 	}
 
-	if err := c.validateRequiredFlags(); err != nil {
-		return err
-	}
 	if c.RunE != nil {
 		if err := c.RunE(c, argWoFlags); err != nil {
 			return err
@@ -896,6 +1361,58 @@ func (c *Command) Execute() error {
 	return err
 }
 
+// osExit is the function ExecuteAndExit uses to exit the program.
+var osExit = os.Exit
+
+// ExecuteAndExit is the same as Execute(), but exits the program afterwards
+// with 0 on success, or with the exit code returned by ExitCodeFunc for the
+// error. Errors are printed by Execute, unless SilenceErrors is set.
+func (c *Command) ExecuteAndExit() {
+	cmd, err := c.ExecuteC()
+	if err == nil {
+		osExit(0)
+		return
+	}
+	if cmd == nil {
+		cmd = c
+	}
+	osExit(cmd.ExitCodeFunc()(err))
+}
+
+// ExecStats describes an execution of the command tree.
+type ExecStats struct {
+	// Commands is the number of commands traversed, from the root command to
+	// the executed one included.
+	Commands int
+	// FlagsChanged is the number of flags set on the command line.
+	FlagsChanged int
+	// ShortCircuited tells if the help or version flag stopped the execution
+	// before the command was run.
+	ShortCircuited bool
+}
+
+// ExecuteWithStats is the same as Execute(), but also returns statistics
+// about the execution.
+func (c *Command) ExecuteWithStats() (ExecStats, error) {
+	var stats ExecStats
+	cmd, err := c.ExecuteC()
+	if cmd == nil {
+		return stats, err
+	}
+
+	for p := cmd; p != nil; p = p.Parent() {
+		stats.Commands++
+	}
+	helpName, _ := cmd.helpFlag()
+	cmd.Flags().Visit(func(f *flag.Flag) {
+		stats.FlagsChanged++
+		if f.Name == helpName || (f.Name == "version" && cmd.Version != "") {
+			stats.ShortCircuited = true
+		}
+	})
+	return stats, err
+}
+
 // ExecuteC executes the command.
 func (c *Command) ExecuteC() (cmd *Command, err error) {
 	if c.ctx == nil {
@@ -926,19 +1443,23 @@ func (c *Command) ExecuteC() (cmd *Command, err error) {
 	// initialize the hidden command to be used for bash completion
 	c.initCompleteCmd(args)
 
-	var flags []string
-	if c.TraverseChildren {
-		cmd, flags, err = c.Traverse(args)
-	} else {
-		cmd, flags, err = c.Find(args)
-	}
+	cmd, flags, err := c.findCommand(args)
 	if err != nil {
+		root := c
 		// If found parse to a subcommand and then failed, talk about the subcommand
 		if cmd != nil {
 			c = cmd
 		}
+		c.callErrorHook(args, err)
 		if !c.SilenceErrors {
 			c.PrintErrln("Error:", err.Error())
+		}
+		// Show the usage of the nearest command for an unknown sub command,
+		// as for flag errors, unless it or the root command silences it, or
+		// else point to its help
+		if _, ok := err.(*unknownCommandError); ok && !c.SilenceUsage && !root.SilenceUsage {
+			c.PrintErrln(c.UsageString())
+		} else if !c.SilenceErrors {
 			c.PrintErrf("Run '%v --help' for usage.\n", c.CommandPath())
 		}
 		return c, err
@@ -963,6 +1484,11 @@ func (c *Command) ExecuteC() (cmd *Command, err error) {
 			cmd.HelpFunc()(cmd, args)
 			return cmd, nil
 		}
+		// Show help instead of the error when a sub command is required
+		if errors.Is(err, ErrSubCommandRequired) {
+			cmd.HelpFunc()(cmd, args)
+			return cmd, err
+		}
 
 		// If root command has SilentErrors flagged,
 		// all subcommands should respect it
@@ -979,6 +1505,72 @@ func (c *Command) ExecuteC() (cmd *Command, err error) {
 	return cmd, err
 }
 
+// RunLine splits line into arguments, honoring shell-style quoting, and runs
+// them through the command tree the same way Execute does with os.Args.
+// It is meant for interactive shells which feed successive lines of input to
+// the same tree: before each line, the flags of every command in the tree are
+// reset to the values they had before they were first parsed so that values
+// set by a previous line do not leak into the next one. The line is not run if
+// a flag cannot be reset. As pflag cannot empty a map, a map flag with an
+// empty default keeps the value of the last line which set it.
+func (c *Command) RunLine(line string) error {
+	args, err := splitArgs(line)
+	if err != nil {
+		return err
+	}
+
+	root := c.Root()
+	if err := root.resetFlagValues(); err != nil {
+		return err
+	}
+	root.SetArgs(args)
+	_, err = root.ExecuteC()
+	return err
+}
+
+// saveFlagStates saves the state of the flags of c which were not parsed
+// yet, for resetFlagValues to restore it.
+func (c *Command) saveFlagStates() {
+	root := c.Root()
+	if root.flagStates == nil {
+		root.flagStates = make(map[*flag.Flag]*flagState)
+	}
+	c.Flags().VisitAll(func(f *flag.Flag) {
+		if _, saved := root.flagStates[f]; !saved {
+			root.flagStates[f] = saveFlagState(f)
+		}
+	})
+}
+
+// resetFlagValues restores all flags of c and its descendants to the state
+// they had before they were first parsed, and forgets how the commands were
+// called. It returns the first error met, after resetting all the flags it
+// can.
+func (c *Command) resetFlagValues() error {
+	var err error
+	states := c.Root().flagStates
+	reset := func(f *flag.Flag) {
+		state, saved := states[f]
+		if !saved {
+			return
+		}
+		if resetErr := state.restore(f); resetErr != nil && err == nil {
+			err = resetErr
+		}
+	}
+	c.Flags().VisitAll(reset)
+	c.PersistentFlags().VisitAll(reset)
+	c.commandCalledAs.name = ""
+	c.commandCalledAs.called = false
+
+	for _, cmd := range c.commands {
+		if cmdErr := cmd.resetFlagValues(); cmdErr != nil && err == nil {
+			err = cmdErr
+		}
+	}
+	return err
+}
+
 func (c *Command) ValidateArgs(args []string) error {
 	if c.Args == nil {
 		return nil
@@ -986,6 +1578,27 @@ func (c *Command) ValidateArgs(args []string) error {
 	return c.Args(c, args)
 }
 
+// validate calls the given validators in order. It returns the first error
+// found or, in AllErrors validation mode, all the errors found.
+func (c *Command) validate(validators ...func() error) error {
+	var errs []error
+	for _, validator := range validators {
+		err := validator()
+		if err == nil {
+			continue
+		}
+		if c.ValidationMode() != AllErrors {
+			return err
+		}
+		if verrs, ok := err.(validationErrors); ok {
+			errs = append(errs, verrs...)
+		} else {
+			errs = append(errs, err)
+		}
+	}
+	return joinValidationErrors(errs)
+}
+
 func (c *Command) validateRequiredFlags() error {
 	if c.DisableFlagParsing {
 		return nil
@@ -993,6 +1606,7 @@ func (c *Command) validateRequiredFlags() error {
 
 	flags := c.Flags()
 	missingFlagNames := []string{}
+	emptyFlagNames := []string{}
 	flags.VisitAll(func(pflag *flag.Flag) {
 		requiredAnnotation, found := pflag.Annotations[BashCompOneRequiredFlag]
 		if !found {
@@ -1000,31 +1614,136 @@ func (c *Command) validateRequiredFlags() error {
 		}
 		if (requiredAnnotation[0] == "true") && !pflag.Changed {
 			missingFlagNames = append(missingFlagNames, pflag.Name)
+		} else if _, nonEmpty := pflag.Annotations[requiredNonEmptyAnnotation]; nonEmpty && pflag.Value.String() == "" {
+			emptyFlagNames = append(emptyFlagNames, pflag.Name)
 		}
 	})
 
+	var errs []error
 	if len(missingFlagNames) > 0 {
-		return fmt.Errorf(`required flag(s) "%s" not set`, strings.Join(missingFlagNames, `", "`))
+		errs = append(errs, fmt.Errorf(`required flag(s) "%s" not set`, strings.Join(missingFlagNames, `", "`)))
+	}
+	if len(emptyFlagNames) > 0 {
+		errs = append(errs, fmt.Errorf(`required flag(s) "%s" set to an empty value`, strings.Join(emptyFlagNames, `", "`)))
+	}
+	if len(errs) > 0 && c.ValidationMode() != AllErrors {
+		return errs[0]
+	}
+	return joinValidationErrors(errs)
+}
+
+// ValidateFlagShorthands checks that no two flags available to c, whether
+// local, persistent or inherited from a parent, use the same shorthand.
+// pflag panics when such flags are merged together, so this should be
+// called before the flags of c are parsed.
+func (c *Command) ValidateFlagShorthands() error {
+	shorthands := map[string]*flag.Flag{}
+	var err error
+	check := func(f *flag.Flag) {
+		if err != nil || f.Shorthand == "" {
+			return
+		}
+		used, found := shorthands[f.Shorthand]
+		if !found {
+			shorthands[f.Shorthand] = f
+			return
+		}
+		if used.Name != f.Name {
+			err = fmt.Errorf("flag shorthand \"-%s\" is used by both \"%s\" and \"%s\" flags of %q",
+				f.Shorthand, used.Name, f.Name, c.CommandPath())
+		}
+	}
+
+	c.Flags().VisitAll(check)
+	c.PersistentFlags().VisitAll(check)
+	c.VisitParents(func(parent *Command) {
+		parent.PersistentFlags().VisitAll(check)
+	})
+	return err
+}
+
+// validateFlagShorthandsTree calls ValidateFlagShorthands on c and all of
+// its descendants, returning the first error found.
+func (c *Command) validateFlagShorthandsTree() error {
+	if err := c.ValidateFlagShorthands(); err != nil {
+		return err
+	}
+	for _, cmd := range c.commands {
+		if err := cmd.validateFlagShorthandsTree(); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// SetHelpFlagName sets the name of the default help flag of the command and
+// its children, "help" by default.
+func (c *Command) SetHelpFlagName(name string) {
+	c.helpFlagName = name
+}
+
+// SetHelpFlagShorthand sets the shorthand of the default help flag of the
+// command and its children, "h" by default. An empty shorthand disables it.
+func (c *Command) SetHelpFlagShorthand(shorthand string) {
+	c.helpFlagShorthand = &shorthand
+}
+
+// helpFlag returns the name and shorthand of the help flag of c, as set by
+// SetHelpFlagName and SetHelpFlagShorthand for this command or a parent.
+func (c *Command) helpFlag() (name, shorthand string) {
+	name, shorthand = "help", "h"
+	for p := c; p != nil; p = p.parent {
+		if p.helpFlagName != "" {
+			name = p.helpFlagName
+			break
+		}
+	}
+	for p := c; p != nil; p = p.parent {
+		if p.helpFlagShorthand != nil {
+			shorthand = *p.helpFlagShorthand
+			break
+		}
+	}
+	return name, shorthand
+}
+
 // InitDefaultHelpFlag adds default help flag to c.
 // It is called automatically by executing the c or by calling help and usage.
-// If c already has help flag, it will do nothing.
+// If c already has help flag, or DisableHelpFlag is set, it will do nothing.
+// The shorthand of the help flag is omitted if c already has a flag using it.
 func (c *Command) InitDefaultHelpFlag() {
 	c.mergePersistentFlags()
-	if c.Flags().Lookup("help") == nil {
-		usage := "help for "
-		if c.Name() == "" {
-			usage += "this command"
-		} else {
-			usage += c.Name()
-		}
-		c.Flags().BoolP("help", "h", false, usage)
+	if f := c.DefaultHelpFlag(); f != nil {
+		c.Flags().AddFlag(f)
 	}
 }
 
+// DefaultHelpFlag returns the help flag which InitDefaultHelpFlag adds to c,
+// without adding it, for instance to document it. It returns nil if c, or a
+// parent, already has a help flag, or if DisableHelpFlag is set.
+func (c *Command) DefaultHelpFlag() *flag.Flag {
+	if c.DisableHelpFlag {
+		return nil
+	}
+	flags := c.mergedFlags()
+	name, shorthand := c.helpFlag()
+	if flags.Lookup(name) != nil {
+		return nil
+	}
+	usage := "help for "
+	if c.Name() == "" {
+		usage += "this command"
+	} else {
+		usage += c.Name()
+	}
+	if shorthand != "" && flags.ShorthandLookup(shorthand) != nil {
+		shorthand = ""
+	}
+	help := flag.NewFlagSet(c.Name(), flag.ContinueOnError)
+	help.BoolP(name, shorthand, false, usage)
+	return help.Lookup(name)
+}
+
 // InitDefaultVersionFlag adds default version flag to c.
 // It is called automatically by executing the c.
 // If c already has a version flag, it will do nothing.
@@ -1063,7 +1782,7 @@ func (c *Command) InitDefaultHelpCmd() {
 			Use:   "help [command]",
 			Short: "Help about any command",
 			Long: `Help provides help for any command in the application.
-Simply type ` + c.Name() + ` help [path to command] for full details.`,
+Simply type ` + c.ProgramName() + ` help [path to command] for full details.`,
 			ValidArgsFunction: func(c *Command, args []string, toComplete string) ([]string, ShellCompDirective) {
 				var completions []string
 				cmd, _, e := c.Root().Find(args)
@@ -1130,6 +1849,11 @@ func (c *Command) AddCommand(cmds ...*Command) {
 		if cmds[i] == c {
 			panic("Command can't be a child of itself")
 		}
+		for p := c.parent; p != nil; p = p.parent {
+			if p == x {
+				panic("Command can't be a child of one of its descendants")
+			}
+		}
 		cmds[i].parent = c
 		// update max lengths
 		usageLen := len(x.Use)
@@ -1153,6 +1877,124 @@ func (c *Command) AddCommand(cmds ...*Command) {
 	}
 }
 
+// AddCommandClone adds a copy of cmd made by DeepCopy to c, and returns the
+// copy. Unlike AddCommand, it allows to add the same command to
+// several parents, each copy having its own parent and CommandPath.
+func (c *Command) AddCommandClone(cmd *Command) *Command {
+	clone := cmd.DeepCopy()
+	c.AddCommand(clone)
+	return clone
+}
+
+// DeepCopy returns a copy of c without a parent, for instance to create
+// several commands from a template. The flag definitions, the sub commands,
+// and the slices and maps of c are copied too, with the parents of the copied
+// sub commands set to their copied parent. The functions of c, such as Run,
+// and the values the flags are bound to are shared with the copy.
+func (c *Command) DeepCopy() *Command {
+	clone := &Command{
+		Use:                        c.Use,
+		Aliases:                    copyStrings(c.Aliases),
+		SuggestFor:                 copyStrings(c.SuggestFor),
+		Short:                      c.Short,
+		Long:                       c.Long,
+		Example:                    c.Example,
+		ValidArgs:                  copyStrings(c.ValidArgs),
+		ValidArgsFunction:          c.ValidArgsFunction,
+		Args:                       c.Args,
+		ArgAliases:                 copyStrings(c.ArgAliases),
+		BashCompletionFunction:     c.BashCompletionFunction,
+		Deprecated:                 c.Deprecated,
+		Hidden:                     c.Hidden,
+		Version:                    c.Version,
+		PersistentPreRun:           c.PersistentPreRun,
+		PersistentPreRunE:          c.PersistentPreRunE,
+		PreRun:                     c.PreRun,
+		PreRunE:                    c.PreRunE,
+		Run:                        c.Run,
+		RunE:                       c.RunE,
+		PostRun:                    c.PostRun,
+		PostRunE:                   c.PostRunE,
+		PersistentPostRun:          c.PersistentPostRun,
+		PersistentPostRunE:         c.PersistentPostRunE,
+		SilenceErrors:              c.SilenceErrors,
+		SilenceUsage:               c.SilenceUsage,
+		DisableFlagParsing:         c.DisableFlagParsing,
+		DisableHelpFlag:            c.DisableHelpFlag,
+		DisableAutoGenTag:          c.DisableAutoGenTag,
+		DisableFlagsInUseLine:      c.DisableFlagsInUseLine,
+		DisableSuggestions:         c.DisableSuggestions,
+		SuggestionsMinimumDistance: c.SuggestionsMinimumDistance,
+		TraverseChildren:           c.TraverseChildren,
+		FParseErrWhitelist:         c.FParseErrWhitelist,
+
+		ctx:               c.ctx,
+		args:              copyStrings(c.args),
+		globNormFunc:      c.globNormFunc,
+		usageFunc:         c.usageFunc,
+		usageTemplate:     c.usageTemplate,
+		useLine:           c.useLine,
+		flagGroupingFunc:  c.flagGroupingFunc,
+		flagGroups:        append([]flagGroup(nil), c.flagGroups...),
+		flagConstraints:   append([]flagConstraint(nil), c.flagConstraints...),
+		flagErrorFunc:     c.flagErrorFunc,
+		exitCodeFunc:      c.exitCodeFunc,
+		helpTemplate:      c.helpTemplate,
+		helpFunc:          c.helpFunc,
+		versionTemplate:   c.versionTemplate,
+		helpFlagName:      c.helpFlagName,
+		helpFlagShorthand: c.helpFlagShorthand,
+		prefixMatching:    c.prefixMatching,
+		argFileExpansion:  c.argFileExpansion,
+		sortFlags:         c.sortFlags,
+		errorPathPrefix:   c.errorPathPrefix,
+		exampleTemplating: c.exampleTemplating,
+		nameColumnWidth:   c.nameColumnWidth,
+		color:             c.color,
+		validationMode:    c.validationMode,
+		inReader:          c.inReader,
+		outWriter:         c.outWriter,
+		errWriter:         c.errWriter,
+	}
+	if c.Annotations != nil {
+		clone.Annotations = make(map[string]string, len(c.Annotations))
+		for k, v := range c.Annotations {
+			clone.Annotations[k] = v
+		}
+	}
+	if c.defaultFlagCompletionFuncs != nil {
+		clone.defaultFlagCompletionFuncs = make(map[string]func(cmd *Command, args []string, toComplete string) ([]string, ShellCompDirective), len(c.defaultFlagCompletionFuncs))
+		for k, v := range c.defaultFlagCompletionFuncs {
+			clone.defaultFlagCompletionFuncs[k] = v
+		}
+	}
+
+	// Only the flags defined on c are copied; the ones merged from its
+	// parents are merged again from the parents of the copy.
+	c.mergePersistentFlags()
+	pflags := c.PersistentFlags()
+	copyFlags(clone.Flags(), c.Flags(), func(f *flag.Flag) bool {
+		return pflags.Lookup(f.Name) != f && c.parentsPflags.Lookup(f.Name) != f
+	})
+	copyFlags(clone.PersistentFlags(), pflags, nil)
+	if c.globNormFunc != nil {
+		clone.Flags().SetNormalizeFunc(c.globNormFunc)
+		clone.PersistentFlags().SetNormalizeFunc(c.globNormFunc)
+	}
+
+	for _, cmd := range c.commands {
+		child := cmd.DeepCopy()
+		if cmd == c.helpCommand {
+			clone.helpCommand = child
+		}
+		clone.AddCommand(child)
+	}
+	if clone.helpCommand == nil && c.helpCommand != nil {
+		clone.helpCommand = c.helpCommand.DeepCopy()
+	}
+	return clone
+}
+
 // RemoveCommand removes one or more commands from a parent command.
 func (c *Command) RemoveCommand(cmds ...*Command) {
 	commands := []*Command{}
@@ -1222,14 +2064,19 @@ func (c *Command) CommandPath() string {
 	if c.HasParent() {
 		return c.Parent().CommandPath() + " " + c.Name()
 	}
-	return c.Name()
+	return c.ProgramName()
 }
 
 // UseLine puts out the full usage for a given command (including parents).
 func (c *Command) UseLine() string {
+	if c.useLine != "" {
+		return c.useLine
+	}
 	var useline string
 	if c.HasParent() {
 		useline = c.parent.CommandPath() + " " + c.Use
+	} else if c.Name() == "" {
+		useline = c.ProgramName() + c.Use
 	} else {
 		useline = c.Use
 	}
@@ -1242,8 +2089,42 @@ func (c *Command) UseLine() string {
 	return useline
 }
 
+// UseLineWithRequiredFlags is the same as UseLine, but also lists the required
+// flags of the command with a placeholder for their value, e.g.
+// "app create --name string [flags]". Templates can use it instead of UseLine.
+func (c *Command) UseLineWithRequiredFlags() string {
+	useline := c.UseLine()
+	var required []string
+	c.mergedFlags().VisitAll(func(f *flag.Flag) {
+		requiredAnnotation, found := f.Annotations[BashCompOneRequiredFlag]
+		if !found || requiredAnnotation[0] != "true" {
+			return
+		}
+		takesArg, name := flagspec.ValueSpec(f)
+		if !takesArg {
+			required = append(required, "--"+f.Name)
+		} else {
+			required = append(required, "--"+f.Name+" "+name)
+		}
+	})
+	if len(required) == 0 {
+		return useline
+	}
+	flags := strings.Join(required, " ")
+	if i := strings.LastIndex(useline, " [flags]"); i >= 0 {
+		return useline[:i] + " " + flags + useline[i:]
+	}
+	return useline + " " + flags
+}
+
+// UsageLine is the same as UseLine. It is available to help and usage
+// templates under both names.
+func (c *Command) UsageLine() string {
+	return c.UseLine()
+}
+
 // DebugFlags used to determine which flags have been assigned to which commands
-// and which persist.
+// and which persist. Hidden flags are left out, as in help and usage.
 func (c *Command) DebugFlags() {
 	c.Println("DebugFlags called on", c.Name())
 	var debugflags func(*Command)
@@ -1254,6 +2135,9 @@ func (c *Command) DebugFlags() {
 		}
 		if x.HasFlags() {
 			x.flags.VisitAll(func(f *flag.Flag) {
+				if f.Hidden {
+					return
+				}
 				if x.HasPersistentFlags() && x.persistentFlag(f.Name) != nil {
 					c.Println("  -"+f.Shorthand+",", "--"+f.Name, "["+f.DefValue+"]", "", f.Value, "  [LP]")
 				} else {
@@ -1263,6 +2147,9 @@ func (c *Command) DebugFlags() {
 		}
 		if x.HasPersistentFlags() {
 			x.pflags.VisitAll(func(f *flag.Flag) {
+				if f.Hidden {
+					return
+				}
 				if x.HasFlags() {
 					if x.flags.Lookup(f.Name) == nil {
 						c.Println("  -"+f.Shorthand+",", "--"+f.Name, "["+f.DefValue+"]", "", f.Value, "  [P]")
@@ -1283,6 +2170,36 @@ func (c *Command) DebugFlags() {
 	debugflags(c)
 }
 
+// DebugTree writes to w the tree of the command and its descendants, one
+// command per line indented by its depth. The name of each command is followed
+// by [R] if it is runnable, [H] if it is hidden, [D] if it is deprecated, and
+// by its aliases.
+func (c *Command) DebugTree(w io.Writer) {
+	var debugtree func(*Command, string)
+
+	debugtree = func(x *Command, indent string) {
+		line := indent + x.Name()
+		if x.Runnable() {
+			line += " [R]"
+		}
+		if x.Hidden {
+			line += " [H]"
+		}
+		if len(x.Deprecated) > 0 {
+			line += " [D]"
+		}
+		if len(x.Aliases) > 0 {
+			line += " (aliases: " + strings.Join(x.Aliases, ", ") + ")"
+		}
+		fmt.Fprintln(w, line)
+		for _, y := range x.Commands() {
+			debugtree(y, indent+"  ")
+		}
+	}
+
+	debugtree(c, "")
+}
+
 // Name returns the command's name: the first word in the use line.
 func (c *Command) Name() string {
 	name := c.Use
@@ -1293,6 +2210,16 @@ func (c *Command) Name() string {
 	return name
 }
 
+// ProgramName returns the name of the program the command belongs to:
+// the name of the root command or, if the root command does not define one,
+// the base name of the executable.
+func (c *Command) ProgramName() string {
+	if name := c.Root().Name(); name != "" {
+		return name
+	}
+	return filepath.Base(os.Args[0])
+}
+
 // HasAlias determines if a given string is an alias of the command.
 func (c *Command) HasAlias(s string) bool {
 	for _, a := range c.Aliases {
@@ -1333,11 +2260,65 @@ func (c *Command) NameAndAliases() string {
 	return strings.Join(append([]string{c.Name()}, c.Aliases...), ", ")
 }
 
+// SetAnnotation sets the annotation key of the command to value.
+// Annotations are purely informational and do not affect execution.
+func (c *Command) SetAnnotation(key, value string) {
+	if c.Annotations == nil {
+		c.Annotations = map[string]string{}
+	}
+	c.Annotations[key] = value
+}
+
+// Annotation returns the value of the annotation key of the command and
+// whether it is set.
+func (c *Command) Annotation(key string) (string, bool) {
+	value, ok := c.Annotations[key]
+	return value, ok
+}
+
 // HasExample determines if the command has example.
 func (c *Command) HasExample() bool {
 	return len(c.Example) > 0
 }
 
+// SetExampleTemplating sets whether the examples of the command and its
+// children are rendered as templates, with the command as data, in help and
+// documentation. It is disabled by default, so that examples showing
+// templates, as with --format '{{.Name}}', are rendered unchanged.
+func (c *Command) SetExampleTemplating(enabled bool) {
+	c.exampleTemplating = &enabled
+}
+
+// exampleTemplatingEnabled reports whether the example of c is rendered as a
+// template, as set by SetExampleTemplating for c or a parent.
+func (c *Command) exampleTemplatingEnabled() bool {
+	for p := c; p != nil; p = p.Parent() {
+		if p.exampleTemplating != nil {
+			return *p.exampleTemplating
+		}
+	}
+	return false
+}
+
+// RenderedExample returns Example as shown in help and documentation. If
+// SetExampleTemplating enabled it, Example is executed as a template with c as
+// data, so that an example can refer to the program as {{.ProgramName}}. An
+// example which is not a valid template is returned as is.
+func (c *Command) RenderedExample() string {
+	if !c.exampleTemplatingEnabled() || !strings.Contains(c.Example, "{{") {
+		return c.Example
+	}
+	t, err := template.New("example").Funcs(templateFuncs).Parse(c.Example)
+	if err != nil {
+		return c.Example
+	}
+	var buf strings.Builder
+	if err := t.Execute(&buf, c); err != nil {
+		return c.Example
+	}
+	return buf.String()
+}
+
 // Runnable determines if the command is itself runnable.
 func (c *Command) Runnable() bool {
 	return c.Run != nil || c.RunE != nil
@@ -1431,7 +2412,17 @@ func (c *Command) GlobalNormalizationFunc() func(f *flag.FlagSet, name string) f
 
 // Flags returns the complete FlagSet that applies
 // to this command (local and persistent declared here and by all parents).
+// The persistent flags of the parents are merged into it when the flags are
+// parsed, and are not kept in a separate set for parsing: commands commonly
+// read the values of inherited flags through Flags(), e.g.
+// cmd.Flags().GetString("config") in Run, and InitDefaultHelpFlag relies on
+// the merge to find a help flag defined by a parent. LocalFlags and
+// InheritedFlags keep telling the local and inherited flags apart, and help,
+// usage and documentation are rendered from them without merging.
 func (c *Command) Flags() *flag.FlagSet {
+	c.flagsMu.Lock()
+	defer c.flagsMu.Unlock()
+
 	if c.flags == nil {
 		c.flags = flag.NewFlagSet(c.Name(), flag.ContinueOnError)
 		if c.flagErrorBuf == nil {
@@ -1458,7 +2449,7 @@ func (c *Command) LocalNonPersistentFlags() *flag.FlagSet {
 
 // LocalFlags returns the local FlagSet specifically set in the current command.
 func (c *Command) LocalFlags() *flag.FlagSet {
-	c.mergePersistentFlags()
+	c.updateParentsPflags()
 
 	if c.lflags == nil {
 		c.lflags = flag.NewFlagSet(c.Name(), flag.ContinueOnError)
@@ -1467,7 +2458,7 @@ func (c *Command) LocalFlags() *flag.FlagSet {
 		}
 		c.lflags.SetOutput(c.flagErrorBuf)
 	}
-	c.lflags.SortFlags = c.Flags().SortFlags
+	c.lflags.SortFlags = c.flagsSorted()
 	if c.globNormFunc != nil {
 		c.lflags.SetNormalizeFunc(c.globNormFunc)
 	}
@@ -1477,14 +2468,14 @@ func (c *Command) LocalFlags() *flag.FlagSet {
 			c.lflags.AddFlag(f)
 		}
 	}
-	c.Flags().VisitAll(addToLocal)
-	c.PersistentFlags().VisitAll(addToLocal)
+	visitFlagsInOrder(c.Flags(), addToLocal)
+	visitFlagsInOrder(c.PersistentFlags(), addToLocal)
 	return c.lflags
 }
 
 // InheritedFlags returns all flags which were inherited from parent commands.
 func (c *Command) InheritedFlags() *flag.FlagSet {
-	c.mergePersistentFlags()
+	c.updateParentsPflags()
 
 	if c.iflags == nil {
 		c.iflags = flag.NewFlagSet(c.Name(), flag.ContinueOnError)
@@ -1495,6 +2486,7 @@ func (c *Command) InheritedFlags() *flag.FlagSet {
 	}
 
 	local := c.LocalFlags()
+	c.iflags.SortFlags = c.flagsSorted()
 	if c.globNormFunc != nil {
 		c.iflags.SetNormalizeFunc(c.globNormFunc)
 	}
@@ -1514,6 +2506,9 @@ func (c *Command) NonInheritedFlags() *flag.FlagSet {
 
 // PersistentFlags returns the persistent FlagSet specifically set in the current command.
 func (c *Command) PersistentFlags() *flag.FlagSet {
+	c.flagsMu.Lock()
+	defer c.flagsMu.Unlock()
+
 	if c.pflags == nil {
 		c.pflags = flag.NewFlagSet(c.Name(), flag.ContinueOnError)
 		if c.flagErrorBuf == nil {
@@ -1524,8 +2519,18 @@ func (c *Command) PersistentFlags() *flag.FlagSet {
 	return c.pflags
 }
 
+// GlobalFlags returns the persistent FlagSet of the root command. The flags
+// defined there apply to the whole program and can be given before or after
+// the name of any sub command.
+func (c *Command) GlobalFlags() *flag.FlagSet {
+	return c.Root().PersistentFlags()
+}
+
 // ResetFlags deletes all flags from command.
 func (c *Command) ResetFlags() {
+	c.flagsMu.Lock()
+	defer c.flagsMu.Unlock()
+
 	c.flagErrorBuf = new(bytes.Buffer)
 	c.flagErrorBuf.Reset()
 	c.flags = flag.NewFlagSet(c.Name(), flag.ContinueOnError)
@@ -1538,9 +2543,31 @@ func (c *Command) ResetFlags() {
 	c.parentsPflags = nil
 }
 
+// ResetFlagsRecursive deletes all flags from the command and all its
+// descendants. If restoreDefaults is true, the variables the deleted flags
+// were bound to are first set back to the values they had before the flags
+// were first parsed, as RunLine does, and the first value which cannot be
+// restored is returned as an error. The flags are deleted either way.
+func (c *Command) ResetFlagsRecursive(restoreDefaults bool) error {
+	var err error
+	if restoreDefaults {
+		err = c.resetFlagValues()
+	}
+	if states := c.Root().flagStates; states != nil {
+		forget := func(f *flag.Flag) { delete(states, f) }
+		c.Flags().VisitAll(forget)
+		c.PersistentFlags().VisitAll(forget)
+	}
+	c.ResetFlags()
+	for _, cmd := range c.commands {
+		cmd.ResetFlagsRecursive(false)
+	}
+	return err
+}
+
 // HasFlags checks if the command contains any flags (local plus persistent from the entire structure).
 func (c *Command) HasFlags() bool {
-	return c.Flags().HasFlags()
+	return c.mergedFlags().HasFlags()
 }
 
 // HasPersistentFlags checks if the command contains persistent flags.
@@ -1561,7 +2588,7 @@ func (c *Command) HasInheritedFlags() bool {
 // HasAvailableFlags checks if the command contains any flags (local plus persistent from the entire
 // structure) which are not hidden or deprecated.
 func (c *Command) HasAvailableFlags() bool {
-	return c.Flags().HasAvailableFlags()
+	return c.mergedFlags().HasAvailableFlags()
 }
 
 // HasAvailablePersistentFlags checks if the command contains persistent flags which are not hidden or deprecated.
@@ -1581,7 +2608,8 @@ func (c *Command) HasAvailableInheritedFlags() bool {
 	return c.InheritedFlags().HasAvailableFlags()
 }
 
-// Flag climbs up the command tree looking for matching flag.
+// Flag climbs up the command tree looking for matching flag. The name is
+// normalized by the normalization function of the flags, if any.
 func (c *Command) Flag(name string) (flag *flag.Flag) {
 	flag = c.Flags().Lookup(name)
 
@@ -1605,7 +2633,8 @@ func (c *Command) persistentFlag(name string) (flag *flag.Flag) {
 	return
 }
 
-// ParseFlags parses persistent flag tree and local flags.
+// ParseFlags parses persistent flag tree and local flags. Undefined flags are
+// reported as an UnknownFlagError.
 func (c *Command) ParseFlags(args []string) error {
 	if c.DisableFlagParsing {
 		return nil
@@ -1616,11 +2645,17 @@ func (c *Command) ParseFlags(args []string) error {
 	}
 	beforeErrorBufLen := c.flagErrorBuf.Len()
 	c.mergePersistentFlags()
+	c.saveFlagStates()
 
 	// do it here after merging all flags and just before parse
 	c.Flags().ParseErrorsWhitelist = flag.ParseErrorsWhitelist(c.FParseErrWhitelist)
 
-	err := c.Flags().Parse(args)
+	c.unknownFlags = nil
+	if c.FParseErrWhitelist.UnknownFlags {
+		c.unknownFlags = unknownFlagArgs(c.Flags(), args)
+	}
+
+	err := wrapFlagError(c.Flags().Parse(args))
 	// Print warnings if they occurred (e.g. deprecated flag messages).
 	if c.flagErrorBuf.Len()-beforeErrorBufLen > 0 && err == nil {
 		c.Print(c.flagErrorBuf.String())
@@ -1642,6 +2677,20 @@ func (c *Command) mergePersistentFlags() {
 	c.Flags().AddFlagSet(c.parentsPflags)
 }
 
+// mergedFlags returns a new flag set with the flags of c, local and inherited,
+// without merging the inherited flags into c.Flags() as mergePersistentFlags
+// does.
+func (c *Command) mergedFlags() *flag.FlagSet {
+	c.updateParentsPflags()
+	merged := flag.NewFlagSet(c.Name(), flag.ContinueOnError)
+	merged.SortFlags = c.Flags().SortFlags
+	merged.SetNormalizeFunc(c.Flags().GetNormalizeFunc())
+	merged.AddFlagSet(c.Flags())
+	merged.AddFlagSet(c.PersistentFlags())
+	merged.AddFlagSet(c.parentsPflags)
+	return merged
+}
+
 // updateParentsPflags updates c.parentsPflags by adding
 // new persistent flags of all parents.
 // If c.parentsPflags == nil, it makes new.
@@ -1659,6 +2708,10 @@ func (c *Command) updateParentsPflags() {
 	c.Root().PersistentFlags().AddFlagSet(flag.CommandLine)
 
 	c.VisitParents(func(parent *Command) {
-		c.parentsPflags.AddFlagSet(parent.PersistentFlags())
+		visitFlagsInOrder(parent.PersistentFlags(), func(f *flag.Flag) {
+			if c.parentsPflags.Lookup(f.Name) == nil {
+				c.parentsPflags.AddFlag(f)
+			}
+		})
 	})
 }
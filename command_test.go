@@ -3,11 +3,14 @@ package cobra
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/spf13/pflag"
@@ -124,6 +127,19 @@ func TestRootExecuteUnknownCommand(t *testing.T) {
 
 	output, _ := executeCommand(rootCmd, "unknown")
 
+	expected := "Error: unknown command \"unknown\" for \"root\"\n" + rootCmd.UsageString() + "\n"
+
+	if output != expected {
+		t.Errorf("Expected:\n %q\nGot:\n %q\n", expected, output)
+	}
+}
+
+func TestRootExecuteUnknownCommandSilenceUsage(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun, SilenceUsage: true}
+	rootCmd.AddCommand(&Command{Use: "child", Run: emptyRun})
+
+	output, _ := executeCommand(rootCmd, "unknown")
+
 	expected := "Error: unknown command \"unknown\" for \"root\"\nRun 'root --help' for usage.\n"
 
 	if output != expected {
@@ -131,6 +147,43 @@ func TestRootExecuteUnknownCommand(t *testing.T) {
 	}
 }
 
+func TestNonRunnableSubcommandUnknownCommand(t *testing.T) {
+	rootRan := false
+	rootCmd := &Command{Use: "myapp", Run: func(*Command, []string) { rootRan = true }}
+	configCmd := &Command{Use: "config"}
+	configCmd.AddCommand(
+		&Command{Use: "get", Run: emptyRun},
+		&Command{Use: "set", Run: emptyRun},
+	)
+	rootCmd.AddCommand(configCmd)
+
+	_, err := executeCommand(rootCmd, "config", "bogus")
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	expected := `unknown command "bogus" for "myapp config"`
+	if got := err.Error(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if rootRan {
+		t.Error("Root command should not have run")
+	}
+}
+
+func TestExecuteUnknownCommandUsage(t *testing.T) {
+	rootCmd := &Command{Use: "myapp"}
+	rootCmd.AddCommand(&Command{Use: "add", Short: "Add an item", Run: emptyRun})
+
+	output, err := executeCommand(rootCmd, "bogus")
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	checkStringOrder(t, output,
+		"Error: unknown command \"bogus\" for \"myapp\"\n",
+		"Usage:\n  myapp [command]\n",
+		"Add an item")
+}
+
 func TestSubcommandExecuteC(t *testing.T) {
 	rootCmd := &Command{Use: "root", Run: emptyRun}
 	childCmd := &Command{Use: "child", Run: emptyRun}
@@ -178,6 +231,35 @@ func TestExecuteContext(t *testing.T) {
 	}
 }
 
+func TestSetContext(t *testing.T) {
+	type key struct{}
+	rootCtx := context.WithValue(context.Background(), key{}, "root")
+	childCtx := context.WithValue(context.Background(), key{}, "child")
+
+	var got []interface{}
+	ctxRun := func(cmd *Command, args []string) {
+		got = append(got, cmd.Context().Value(key{}))
+	}
+	rootCmd := &Command{Use: "root", Run: ctxRun}
+	childCmd := &Command{Use: "child", Run: ctxRun}
+	otherCmd := &Command{Use: "other", Run: ctxRun}
+	rootCmd.AddCommand(childCmd, otherCmd)
+
+	rootCmd.SetContext(rootCtx)
+	childCmd.SetContext(childCtx)
+
+	for _, args := range [][]string{{}, {"child"}, {"other"}} {
+		if _, err := executeCommand(rootCmd, args...); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+
+	expected := []interface{}{"root", "child", "root"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected context values %v, got %v", expected, got)
+	}
+}
+
 func TestExecute_NoContext(t *testing.T) {
 	run := func(cmd *Command, args []string) {
 		if cmd.Context() != context.Background() {
@@ -315,6 +397,109 @@ func TestAliasPrefixMatching(t *testing.T) {
 	EnablePrefixMatching = false
 }
 
+func TestFindNameBeatsAlias(t *testing.T) {
+	var called string
+	rootCmd := &Command{Use: "root", Args: NoArgs, Run: emptyRun}
+	showCmd := &Command{
+		Use:     "show",
+		Aliases: []string{"list"},
+		Run:     func(c *Command, _ []string) { called = c.Name() },
+	}
+	listCmd := &Command{
+		Use: "list",
+		Run: func(c *Command, _ []string) { called = c.Name() },
+	}
+	rootCmd.AddCommand(showCmd, listCmd)
+
+	if _, err := executeCommand(rootCmd, "list"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if called != "list" {
+		t.Errorf("Expected the command named %q to win over the alias, got %q", "list", called)
+	}
+}
+
+func TestFindAliasBeatsPrefix(t *testing.T) {
+	defer func(ov bool) { EnablePrefixMatching = ov }(EnablePrefixMatching)
+	EnablePrefixMatching = true
+
+	var called string
+	rootCmd := &Command{Use: "root", Args: NoArgs, Run: emptyRun}
+	stCmd := &Command{
+		Use: "status",
+		Run: func(c *Command, _ []string) { called = c.Name() },
+	}
+	stopCmd := &Command{
+		Use:     "stop",
+		Aliases: []string{"st"},
+		Run:     func(c *Command, _ []string) { called = c.Name() },
+	}
+	rootCmd.AddCommand(stCmd, stopCmd)
+
+	if _, err := executeCommand(rootCmd, "st"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if called != "stop" {
+		t.Errorf("Expected the alias to win over the prefix, got %q", called)
+	}
+}
+
+func TestFindAmbiguousPrefix(t *testing.T) {
+	defer func(ov bool) { EnablePrefixMatching = ov }(EnablePrefixMatching)
+	EnablePrefixMatching = true
+
+	rootCmd := &Command{Use: "root", Args: NoArgs, Run: emptyRun}
+	startCmd := &Command{Use: "start", Run: emptyRun}
+	stopCmd := &Command{Use: "stop", Run: emptyRun}
+	rootCmd.AddCommand(startCmd, stopCmd)
+
+	for _, traverse := range []bool{false, true} {
+		rootCmd.TraverseChildren = traverse
+		_, err := executeCommand(rootCmd, "st")
+		expected := `ambiguous command "st" for "root", could be: start, stop`
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error %q, got %v", expected, err)
+		}
+	}
+}
+
+func TestSetPrefixMatching(t *testing.T) {
+	var called string
+	rootCmd := &Command{Use: "root", Args: NoArgs, Run: emptyRun}
+	run := func(c *Command, _ []string) { called = c.Name() }
+	commitCmd := &Command{Use: "commit", Run: run}
+	comCmd := &Command{Use: "com", Run: run}
+	configCmd := &Command{Use: "config", Run: run}
+	rootCmd.AddCommand(commitCmd, comCmd, configCmd)
+
+	if _, err := executeCommand(rootCmd, "comm"); err == nil {
+		t.Error("Expected an error with prefix matching disabled by default")
+	}
+
+	rootCmd.SetPrefixMatching(true)
+
+	if _, err := executeCommand(rootCmd, "comm"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if called != "commit" {
+		t.Errorf("Expected the unique prefix to resolve to %q, got %q", "commit", called)
+	}
+
+	// An exact match wins over the prefix of other commands
+	if _, err := executeCommand(rootCmd, "com"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if called != "com" {
+		t.Errorf("Expected the exact match %q, got %q", "com", called)
+	}
+
+	_, err := executeCommand(rootCmd, "co")
+	expected := `ambiguous command "co" for "root", could be: com, commit, config`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
+
 // TestChildSameName checks the correct behaviour of cobra in cases,
 // when an application with name "foo" and with subcommand "foo"
 // is executed with args "foo foo".
@@ -412,6 +597,37 @@ func TestFlagLong(t *testing.T) {
 	}
 }
 
+func TestArgsAfterDashNotParsed(t *testing.T) {
+	var runArgs []string
+	var verbose bool
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	runCmd := &Command{
+		Use:  "run",
+		Args: ArbitraryArgs,
+		Run:  func(_ *Command, args []string) { runArgs = args },
+	}
+	runCmd.Flags().BoolVarP(&verbose, "verbose", "l", false, "")
+	rootCmd.AddCommand(runCmd)
+
+	output, err := executeCommand(rootCmd, "run", "--", "ls", "-la", "--verbose", "--help")
+	if output != "" {
+		t.Errorf("Unexpected output: %v", output)
+	}
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if expected := []string{"ls", "-la", "--verbose", "--help"}; !reflect.DeepEqual(runArgs, expected) {
+		t.Errorf("Expected arguments: %q, got %q", expected, runArgs)
+	}
+	if verbose {
+		t.Error("Expected the arguments after -- not to be parsed as flags")
+	}
+	if runCmd.ArgsLenAtDash() != 0 {
+		t.Errorf("Expected ArgsLenAtDash: %v but got %v", 0, runCmd.ArgsLenAtDash())
+	}
+}
+
 func TestFlagShort(t *testing.T) {
 	var cArgs []string
 	c := &Command{
@@ -707,6 +923,38 @@ func TestOverwrittenFlag(t *testing.T) {
 	}
 }
 
+func TestInheritedFlagsAfterNewParentFlag(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	parent := &Command{Use: "parent", Run: emptyRun}
+	child := &Command{Use: "child", Run: emptyRun}
+	root.AddCommand(parent)
+	parent.AddCommand(child)
+
+	root.PersistentFlags().String("config", "", "")
+	if child.InheritedFlags().Lookup("config") == nil {
+		t.Fatal(`InheritedFlags expected to contain "config", got "nil"`)
+	}
+	if child.InheritedFlags().Lookup("verbose") != nil {
+		t.Fatal(`InheritedFlags should not contain "verbose" yet`)
+	}
+
+	root.PersistentFlags().Bool("verbose", false, "")
+	parent.PersistentFlags().Int("retries", 0, "")
+
+	inherited := child.InheritedFlags()
+	for _, name := range []string{"config", "verbose", "retries"} {
+		if inherited.Lookup(name) == nil {
+			t.Errorf("InheritedFlags expected to contain %q, got \"nil\"", name)
+		}
+	}
+	if !child.HasAvailableInheritedFlags() {
+		t.Error("Expected the child to have available inherited flags")
+	}
+	if child.Flag("retries") == nil {
+		t.Error(`Flag expected to find "retries", got "nil"`)
+	}
+}
+
 func TestPersistentFlagsOnChild(t *testing.T) {
 	var childCmdArgs []string
 	rootCmd := &Command{Use: "root", Run: emptyRun}
@@ -761,6 +1009,39 @@ func TestRequiredFlags(t *testing.T) {
 	}
 }
 
+func TestRequiredNonEmptyFlags(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{nil, fmt.Sprintf("required flag(s) %q not set", "name")},
+		{[]string{"--name="}, fmt.Sprintf("required flag(s) %q set to an empty value", "name")},
+		{[]string{"--name", ""}, fmt.Sprintf("required flag(s) %q set to an empty value", "name")},
+		{[]string{"--name", "foo"}, ""},
+	}
+	for _, tc := range tests {
+		c := &Command{Use: "c", Run: emptyRun}
+		c.Flags().String("name", "", "")
+		if err := c.MarkFlagRequiredNonEmpty("name"); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := executeCommand(c, tc.args...)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tc.expected {
+			t.Errorf("%v: expected error %q, got %q", tc.args, tc.expected, got)
+		}
+	}
+
+	c := &Command{Use: "c", Run: emptyRun}
+	if err := c.MarkFlagRequiredNonEmpty("missing"); err == nil {
+		t.Error("Expected an error marking a flag which does not exist")
+	}
+}
+
 func TestPersistentRequiredFlags(t *testing.T) {
 	parent := &Command{Use: "parent", Run: emptyRun}
 	parent.PersistentFlags().String("foo1", "", "")
@@ -831,6 +1112,96 @@ func TestInitHelpFlagMergesFlags(t *testing.T) {
 	}
 }
 
+func TestDefaultHelpFlag(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	rootCmd.PersistentFlags().BoolP("hidden-files", "h", false, "")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	rootCmd.AddCommand(childCmd)
+
+	help := childCmd.DefaultHelpFlag()
+	if help == nil || help.Name != "help" || help.Shorthand != "" || help.Usage != "help for child" {
+		t.Fatalf("Expected a help flag without shorthand, got %+v", help)
+	}
+	if childCmd.Flags().Lookup("help") != nil || childCmd.Flags().Lookup("hidden-files") != nil {
+		t.Error("Expected the flags of the command to be left unchanged")
+	}
+
+	rootCmd.PersistentFlags().Bool("help", false, "custom help")
+	if help := childCmd.DefaultHelpFlag(); help != nil {
+		t.Errorf("Expected no default help flag when a parent defines one, got %+v", help)
+	}
+}
+
+func TestHelpRenderingDoesNotMergeFlags(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	rootCmd.PersistentFlags().String("config", "", "config file")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().Bool("force", false, "")
+	if err := childCmd.MarkFlagRequired("force"); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.AddCommand(childCmd)
+
+	buf := new(bytes.Buffer)
+	childCmd.SetOut(buf)
+	if err := childCmd.Help(); err != nil {
+		t.Fatal(err)
+	}
+	checkStringContains(t, buf.String(), "--config")
+	checkStringContains(t, childCmd.UsageString(), "Global Flags:")
+	checkStringContains(t, childCmd.UseLineWithRequiredFlags(), "--force")
+	if !childCmd.HasAvailableInheritedFlags() || !childCmd.HasAvailableFlags() {
+		t.Error("Expected the child to have available flags")
+	}
+
+	if childCmd.Flags().Lookup("config") != nil {
+		t.Error(`Expected the inherited "config" flag not to be merged into Flags()`)
+	}
+	if childCmd.LocalFlags().Lookup("config") != nil || childCmd.InheritedFlags().Lookup("config") == nil {
+		t.Error(`Expected "config" to be reported as an inherited flag`)
+	}
+}
+
+func TestLocalFlagsStableAcrossParsing(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	rootCmd.PersistentFlags().String("config", "", "config file")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().Int("count", 0, "")
+	childCmd.PersistentFlags().Bool("dry-run", false, "")
+	rootCmd.AddCommand(childCmd)
+
+	names := func(flags *pflag.FlagSet) []string {
+		var names []string
+		flags.VisitAll(func(f *pflag.Flag) { names = append(names, f.Name) })
+		return names
+	}
+	localBefore := names(childCmd.LocalFlags())
+	inheritedBefore := names(childCmd.InheritedFlags())
+	usageBefore := childCmd.UsageString()
+
+	for i := 0; i < 2; i++ {
+		if err := childCmd.ParseFlags([]string{"--count", "2", "--config", "c.yaml"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if got := names(childCmd.LocalFlags()); !reflect.DeepEqual(got, localBefore) {
+		t.Errorf("Expected local flags %v, got %v", localBefore, got)
+	}
+	if got := names(childCmd.InheritedFlags()); !reflect.DeepEqual(got, inheritedBefore) {
+		t.Errorf("Expected inherited flags %v, got %v", inheritedBefore, got)
+	}
+	if !childCmd.HasLocalFlags() || childCmd.LocalFlags().Lookup("config") != nil {
+		t.Error(`Expected "config" not to be reported as a local flag`)
+	}
+	if got := childCmd.UsageString(); got != usageBefore {
+		t.Errorf("Expected the usage to be unchanged by parsing:\n%s\ngot:\n%s", usageBefore, got)
+	}
+	if v, _ := childCmd.Flags().GetString("config"); v != "c.yaml" {
+		t.Errorf("Expected the inherited flag to be parsed, got %q", v)
+	}
+}
+
 func TestHelpCommandExecuted(t *testing.T) {
 	rootCmd := &Command{Use: "root", Long: "Long description", Run: emptyRun}
 	rootCmd.AddCommand(&Command{Use: "child", Run: emptyRun})
@@ -921,6 +1292,57 @@ func TestHelpFlagInHelp(t *testing.T) {
 	checkStringContains(t, output, "[flags]")
 }
 
+func TestHelpFlagShorthandOnlyAddedIfShorthandNotDefined(t *testing.T) {
+	var host string
+	rootCmd := &Command{Use: "root", Run: func(*Command, []string) {}}
+	rootCmd.Flags().StringVarP(&host, "host", "h", "", "server host")
+
+	output, err := executeCommand(rootCmd, "-h", "example.com")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if output != "" {
+		t.Errorf("Unexpected output: %q", output)
+	}
+	if host != "example.com" {
+		t.Errorf("Expected host %q, got %q", "example.com", host)
+	}
+	if rootCmd.Flags().Lookup("help").Shorthand != "" {
+		t.Errorf("Expected the help flag to have no shorthand")
+	}
+
+	output, err = executeCommand(rootCmd, "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "  -h, --host string   server host\n")
+	checkStringContains(t, output, "      --help          help for root\n")
+}
+
+func TestSetHelpFlagNameAndShorthand(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: func(*Command, []string) {}}
+	rootCmd.SetHelpFlagName("aide")
+	rootCmd.SetHelpFlagShorthand("?")
+	childCmd := &Command{Use: "child", Run: func(*Command, []string) {}}
+	rootCmd.AddCommand(childCmd)
+
+	output, err := executeCommand(rootCmd, "child", "-?")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "  -?, --aide   help for child\n")
+	if childCmd.Flags().Lookup("help") != nil {
+		t.Error(`Expected no "help" flag`)
+	}
+
+	rootCmd.SetHelpFlagShorthand("")
+	output, err = executeCommand(rootCmd, "--aide")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "      --aide   help for root\n")
+}
+
 func TestFlagsInUsage(t *testing.T) {
 	rootCmd := &Command{Use: "root", Args: NoArgs, Run: func(*Command, []string) {}}
 	output, err := executeCommand(rootCmd, "--help")
@@ -1156,6 +1578,60 @@ func TestVisitParents(t *testing.T) {
 	}
 }
 
+func TestVisitAll(t *testing.T) {
+	c := &Command{Use: "app"}
+	sub := &Command{Use: "sub"}
+	dsub := &Command{Use: "dsub"}
+	other := &Command{Use: "other"}
+	sub.AddCommand(dsub)
+	c.AddCommand(sub, other)
+
+	var visited []string
+	c.VisitAll(func(x *Command) {
+		if x.Annotations == nil {
+			x.Annotations = map[string]string{}
+		}
+		x.Annotations["telemetry"] = "on"
+		visited = append(visited, x.Name())
+	})
+
+	if expected := []string{"app", "other", "sub", "dsub"}; !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Expected to visit %v, visited %v", expected, visited)
+	}
+	for _, x := range []*Command{c, sub, dsub, other} {
+		if x.Annotations["telemetry"] != "on" {
+			t.Errorf("Expected %q to be annotated", x.Name())
+		}
+	}
+}
+
+func TestAllCommandPaths(t *testing.T) {
+	rootCmd := &Command{Use: "mycmd", Run: emptyRun}
+	sub1 := &Command{Use: "sub1"}
+	sub1.AddCommand(
+		&Command{Use: "sub1sub1", Run: emptyRun},
+		&Command{Use: "sub1sub2", Run: emptyRun},
+	)
+	sub2 := &Command{Use: "sub2", Run: emptyRun}
+	sub2.AddCommand(
+		&Command{Use: "sub2sub1", Run: emptyRun, Hidden: true},
+		&Command{Use: "sub2sub2", Run: emptyRun, Deprecated: "use sub1"},
+		&Command{Use: "sub2sub3", Run: emptyRun},
+	)
+	rootCmd.AddCommand(sub2, sub1, &Command{Use: "topic", Short: "A help topic"})
+
+	expected := []string{
+		"mycmd",
+		"mycmd sub1 sub1sub1",
+		"mycmd sub1 sub1sub2",
+		"mycmd sub2",
+		"mycmd sub2 sub2sub3",
+	}
+	if got := rootCmd.AllCommandPaths(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
 func TestSuggestions(t *testing.T) {
 	rootCmd := &Command{Use: "root", Run: emptyRun}
 	timesCmd := &Command{
@@ -1165,8 +1641,8 @@ func TestSuggestions(t *testing.T) {
 	}
 	rootCmd.AddCommand(timesCmd)
 
-	templateWithSuggestions := "Error: unknown command \"%s\" for \"root\"\n\nDid you mean this?\n\t%s\n\nRun 'root --help' for usage.\n"
-	templateWithoutSuggestions := "Error: unknown command \"%s\" for \"root\"\nRun 'root --help' for usage.\n"
+	templateWithSuggestions := "Error: unknown command \"%s\" for \"root\"\n\nDid you mean this?\n\t%s\n\n%s\n"
+	templateWithoutSuggestions := "Error: unknown command \"%s\" for \"root\"\n%s\n"
 
 	tests := map[string]string{
 		"time":     "times",
@@ -1189,11 +1665,12 @@ func TestSuggestions(t *testing.T) {
 
 			var expected string
 			output, _ := executeCommand(rootCmd, typo)
+			usage := rootCmd.UsageString()
 
 			if suggestion == "" || suggestionsDisabled {
-				expected = fmt.Sprintf(templateWithoutSuggestions, typo)
+				expected = fmt.Sprintf(templateWithoutSuggestions, typo, usage)
 			} else {
-				expected = fmt.Sprintf(templateWithSuggestions, typo, suggestion)
+				expected = fmt.Sprintf(templateWithSuggestions, typo, suggestion, usage)
 			}
 
 			if output != expected {
@@ -1203,6 +1680,26 @@ func TestSuggestions(t *testing.T) {
 	}
 }
 
+func TestUnknownCommandHonorsRootSilenceUsage(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun, SilenceUsage: true}
+	groupCmd := &Command{Use: "group"}
+	groupCmd.AddCommand(&Command{Use: "child", Run: emptyRun})
+	rootCmd.AddCommand(groupCmd)
+
+	output, err := executeCommand(rootCmd, "group", "unknown")
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	expected := "Error: unknown command \"unknown\" for \"root group\"\nRun 'root group --help' for usage.\n"
+	if output != expected {
+		t.Errorf("Unexpected response.\nExpected:\n %q\nGot:\n %q\n", expected, output)
+	}
+
+	rootCmd.SilenceUsage = false
+	output, _ = executeCommand(rootCmd, "group", "unknown")
+	checkStringContains(t, output, groupCmd.UsageString())
+}
+
 func TestRemoveCommand(t *testing.T) {
 	rootCmd := &Command{Use: "root", Args: NoArgs, Run: emptyRun}
 	childCmd := &Command{Use: "child", Run: emptyRun}
@@ -1316,6 +1813,85 @@ func TestHooks(t *testing.T) {
 	}
 }
 
+func TestPreRunSeesValidatedFlags(t *testing.T) {
+	var preRunPort int
+	var preRunCalled bool
+	getCmd := func() *Command {
+		rootCmd := &Command{
+			Use:  "root",
+			Args: ExactArgs(1),
+			PreRun: func(cmd *Command, args []string) {
+				preRunCalled = true
+				preRunPort, _ = cmd.Flags().GetInt("port")
+			},
+			Run: emptyRun,
+		}
+		rootCmd.Flags().Int("port", 0, "")
+		rootCmd.Flags().String("host", "", "")
+		if err := rootCmd.MarkFlagRequired("host"); err != nil {
+			t.Fatal(err)
+		}
+		return rootCmd
+	}
+
+	if _, err := executeCommand(getCmd(), "--port", "8080", "--host", "example.com", "arg"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if preRunPort != 8080 {
+		t.Errorf("Expected PreRun to see port 8080, got %d", preRunPort)
+	}
+
+	for _, tc := range []struct {
+		args        []string
+		expectedErr string
+	}{
+		{[]string{"--port", "8080", "arg"}, `required flag(s) "host" not set`},
+		{[]string{"--host", "example.com"}, "accepts 1 arg(s), received 0"},
+	} {
+		preRunCalled = false
+		_, err := executeCommand(getCmd(), tc.args...)
+		if err == nil {
+			t.Errorf("Expected a validation error for %v", tc.args)
+		} else if err.Error() != tc.expectedErr {
+			t.Errorf("Expected error %q for %v, got %q", tc.expectedErr, tc.args, err)
+		}
+		if preRunCalled {
+			t.Errorf("Expected PreRun not to be called for %v", tc.args)
+		}
+	}
+}
+
+func TestPersistentPreRunEError(t *testing.T) {
+	var called []string
+	hookErr := errors.New("not logged in")
+	rootCmd := &Command{
+		Use: "root",
+		PersistentPreRunE: func(*Command, []string) error {
+			called = append(called, "PersistentPreRunE")
+			return hookErr
+		},
+		PersistentPostRunE: func(*Command, []string) error {
+			called = append(called, "PersistentPostRunE")
+			return nil
+		},
+	}
+	childCmd := &Command{
+		Use:     "child",
+		PreRun:  func(*Command, []string) { called = append(called, "PreRun") },
+		Run:     func(*Command, []string) { called = append(called, "Run") },
+		PostRun: func(*Command, []string) { called = append(called, "PostRun") },
+	}
+	rootCmd.AddCommand(childCmd)
+
+	_, err := executeCommand(rootCmd, "child")
+	if err != hookErr {
+		t.Errorf("Expected error %v, got %v", hookErr, err)
+	}
+	if !reflect.DeepEqual(called, []string{"PersistentPreRunE"}) {
+		t.Errorf("Expected only PersistentPreRunE to be called, got %v", called)
+	}
+}
+
 func TestPersistentHooks(t *testing.T) {
 	var (
 		parentPersPreArgs  string
@@ -1483,22 +2059,52 @@ func TestNormPassedOnInherited(t *testing.T) {
 	}
 }
 
-// Related to https://github.com/spf13/cobra/issues/521.
-func TestConsistentNormalizedName(t *testing.T) {
+func TestNormPassedOnSubtreeAddedLater(t *testing.T) {
 	toUpper := func(f *pflag.FlagSet, name string) pflag.NormalizedName {
 		return pflag.NormalizedName(strings.ToUpper(name))
 	}
-	n := func(f *pflag.FlagSet, name string) pflag.NormalizedName {
-		return pflag.NormalizedName(name)
-	}
 
-	c := &Command{}
-	c.Flags().Bool("flagname", true, "")
-	c.SetGlobalNormalizationFunc(toUpper)
-	c.SetGlobalNormalizationFunc(n)
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	rootCmd.SetGlobalNormalizationFunc(toUpper)
 
-	if c.LocalFlags().Lookup("flagname") == c.LocalFlags().Lookup("FLAGNAME") {
-		t.Error("Normalizing flag names should not result in duplicate flags")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	grandchildCmd := &Command{Use: "grandchild", Run: emptyRun}
+	grandchildCmd.Flags().String("name", "", "")
+	childCmd.AddCommand(grandchildCmd)
+	childCmd.Flags().Bool("dry-run", false, "")
+	rootCmd.AddCommand(childCmd)
+
+	if childCmd.Flags().Lookup("dry-run") != childCmd.Flags().Lookup("DRY-RUN") {
+		t.Error("Normalization function should be passed on to the flags of a command added later")
+	}
+	if grandchildCmd.Flags().Lookup("name") != grandchildCmd.Flags().Lookup("NAME") {
+		t.Error("Normalization function should be passed on to the descendants of a command added later")
+	}
+
+	if _, err := executeCommand(rootCmd, "child", "grandchild", "--NAME", "foo"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if name, _ := grandchildCmd.Flags().GetString("name"); name != "foo" {
+		t.Errorf("Expected name %q, got %q", "foo", name)
+	}
+}
+
+// Related to https://github.com/spf13/cobra/issues/521.
+func TestConsistentNormalizedName(t *testing.T) {
+	toUpper := func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		return pflag.NormalizedName(strings.ToUpper(name))
+	}
+	n := func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		return pflag.NormalizedName(name)
+	}
+
+	c := &Command{}
+	c.Flags().Bool("flagname", true, "")
+	c.SetGlobalNormalizationFunc(toUpper)
+	c.SetGlobalNormalizationFunc(n)
+
+	if c.LocalFlags().Lookup("flagname") == c.LocalFlags().Lookup("FLAGNAME") {
+		t.Error("Normalizing flag names should not result in duplicate flags")
 	}
 }
 
@@ -1515,6 +2121,49 @@ func TestFlagOnPflagCommandLine(t *testing.T) {
 	resetCommandLineFlagSet()
 }
 
+func TestFlagLookupNormalizesName(t *testing.T) {
+	renamed := func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "old" {
+			name = "new"
+		}
+		return pflag.NormalizedName(name)
+	}
+
+	var oldFlag, persistentFlag *pflag.Flag
+	var oldChanged bool
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().String("new-global", "", "")
+	child := &Command{
+		Use: "child",
+		Run: func(cmd *Command, _ []string) {
+			oldFlag = cmd.Flag("old")
+			persistentFlag = cmd.Flag("old-global")
+			oldChanged = cmd.FlagChanged("old")
+		},
+	}
+	child.Flags().String("new", "", "")
+	root.AddCommand(child)
+	root.SetGlobalNormalizationFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "old-global" {
+			name = "new-global"
+		}
+		return renamed(f, name)
+	})
+
+	if _, err := executeCommand(root, "child", "--old", "value"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if oldFlag == nil || oldFlag != child.Flags().Lookup("new") {
+		t.Errorf(`Expected Flag("old") to resolve to the "new" flag, got %v`, oldFlag)
+	}
+	if persistentFlag == nil || persistentFlag.Name != "new-global" {
+		t.Errorf(`Expected Flag("old-global") to resolve to the "new-global" flag, got %v`, persistentFlag)
+	}
+	if !oldChanged {
+		t.Error(`Expected FlagChanged("old") to report the "new" flag as changed`)
+	}
+}
+
 // TestHiddenCommandExecutes checks,
 // if hidden commands run as intended.
 func TestHiddenCommandExecutes(t *testing.T) {
@@ -1927,6 +2576,29 @@ func TestCalledAs(t *testing.T) {
 	}
 }
 
+func TestCalledAsNestedAlias(t *testing.T) {
+	var calledAs string
+	root := &Command{Use: "root", Run: emptyRun}
+	parentCmd := &Command{Use: "parent", Aliases: []string{"p"}, Run: emptyRun}
+	childCmd := &Command{
+		Use:     "child",
+		Aliases: []string{"c", "kid"},
+		Run:     func(c *Command, _ []string) { calledAs = c.CalledAs() },
+	}
+	parentCmd.AddCommand(childCmd)
+	root.AddCommand(parentCmd)
+
+	if _, err := executeCommand(root, "p", "kid"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calledAs != "kid" {
+		t.Errorf("Expected CalledAs() to be %q inside Run, got %q", "kid", calledAs)
+	}
+	if got := parentCmd.CalledAs(); got != "" {
+		t.Errorf("Expected CalledAs() of a command that was not run to be empty, got %q", got)
+	}
+}
+
 func TestFParseErrWhitelistBackwardCompatibility(t *testing.T) {
 	c := &Command{Use: "c", Run: emptyRun}
 	c.Flags().BoolP("boola", "a", false, "a boolean flag")
@@ -1978,6 +2650,36 @@ func TestFParseErrWhitelistParentCommand(t *testing.T) {
 	checkStringContains(t, output, "unknown flag: --unknown")
 }
 
+func TestFParseErrWhitelistParentCommandDoesNotLeak(t *testing.T) {
+	for _, traverse := range []bool{false, true} {
+		root := &Command{
+			Use:              "root",
+			Run:              emptyRun,
+			TraverseChildren: traverse,
+			FParseErrWhitelist: FParseErrWhitelist{
+				UnknownFlags: true,
+			},
+		}
+		root.PersistentFlags().Bool("verbose", false, "")
+
+		c := &Command{
+			Use: "child",
+			Run: emptyRun,
+		}
+		root.AddCommand(c)
+
+		if _, err := executeCommand(root, "--unknown", "--verbose"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		output, err := executeCommand(root, "child", "--verbose", "--unknown")
+		if err == nil {
+			t.Errorf("expected unknown flag error (traverse: %v)", traverse)
+		}
+		checkStringContains(t, output, "unknown flag: --unknown")
+	}
+}
+
 func TestFParseErrWhitelistChildCommand(t *testing.T) {
 	root := &Command{
 		Use: "root",
@@ -2031,3 +2733,1468 @@ func TestFParseErrWhitelistSiblingCommand(t *testing.T) {
 	}
 	checkStringContains(t, output, "unknown flag: --unknown")
 }
+
+func TestUnknownFlags(t *testing.T) {
+	tests := []struct {
+		args            []string
+		expectedUnknown []string
+		expectedArgs    []string
+	}{
+		{[]string{"--verbose", "--foreign=1", "positional"}, []string{"--foreign=1"}, []string{"positional"}},
+		{[]string{"--foreign", "1", "positional"}, []string{"--foreign", "1"}, []string{"positional"}},
+		{[]string{"--foreign", "--verbose", "positional"}, []string{"--foreign"}, []string{"positional"}},
+		{[]string{"--name", "-x", "-vy=2", "positional"}, []string{"-y=2"}, []string{"positional"}},
+		{[]string{"-nfoo", "-x", "positional"}, []string{"-x", "positional"}, []string{}},
+		{[]string{"positional", "--", "--foreign"}, nil, []string{"positional", "--foreign"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+			var gotArgs []string
+			c := &Command{
+				Use: "proxy",
+				Run: func(_ *Command, args []string) { gotArgs = args },
+				FParseErrWhitelist: FParseErrWhitelist{
+					UnknownFlags: true,
+				},
+			}
+			c.Flags().BoolP("verbose", "v", false, "")
+			c.Flags().StringP("name", "n", "", "")
+
+			if _, err := executeCommand(c, tc.args...); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(c.UnknownFlags(), tc.expectedUnknown) {
+				t.Errorf("Expected unknown flags %q, got %q", tc.expectedUnknown, c.UnknownFlags())
+			}
+			if !reflect.DeepEqual(gotArgs, tc.expectedArgs) {
+				t.Errorf("Expected args %q, got %q", tc.expectedArgs, gotArgs)
+			}
+		})
+	}
+}
+
+func TestRunLineResetsFlags(t *testing.T) {
+	var names []string
+	var changed []bool
+	root := &Command{Use: "root", Run: emptyRun}
+	childCmd := &Command{
+		Use: "child",
+		Run: func(c *Command, _ []string) {
+			name, _ := c.Flags().GetString("name")
+			names = append(names, name)
+			changed = append(changed, c.Flags().Changed("name"))
+		},
+	}
+	childCmd.Flags().String("name", "default", "")
+	root.AddCommand(childCmd)
+
+	buf := new(bytes.Buffer)
+	root.SetOut(buf)
+	root.SetErr(buf)
+
+	for _, line := range []string{"child --name first", "child --name second", "child"} {
+		if err := root.RunLine(line); err != nil {
+			t.Fatalf("Unexpected error for %q: %v", line, err)
+		}
+	}
+
+	expected := []string{"first", "second", "default"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected flag values %v, got %v", expected, names)
+	}
+	if !reflect.DeepEqual(changed, []bool{true, true, false}) {
+		t.Errorf("Expected the last line to leave the flag unchanged, got %v", changed)
+	}
+}
+
+func TestRunLineResetsSliceAndMapFlags(t *testing.T) {
+	var (
+		tags   []string
+		labels map[string]string
+		limits map[string]int
+	)
+	root := &Command{Use: "root", Run: emptyRun}
+	root.Flags().StringSliceVar(&tags, "tags", []string{"a", `b,c`}, "")
+	root.Flags().StringToStringVar(&labels, "labels", map[string]string{"team": "core"}, "")
+	root.Flags().StringToIntVar(&limits, "limits", map[string]int{"cpu": 1}, "")
+
+	for _, line := range []string{
+		"--tags b --labels env=prod --limits mem=2",
+		"--tags c --labels zone=eu --limits cpu=3",
+	} {
+		if err := root.RunLine(line); err != nil {
+			t.Fatalf("Unexpected error for %q: %v", line, err)
+		}
+	}
+	if !reflect.DeepEqual(tags, []string{"c"}) {
+		t.Errorf("Expected tags [c], got %v", tags)
+	}
+	if !reflect.DeepEqual(labels, map[string]string{"zone": "eu"}) {
+		t.Errorf("Expected labels map[zone:eu], got %v", labels)
+	}
+	if !reflect.DeepEqual(limits, map[string]int{"cpu": 3}) {
+		t.Errorf("Expected limits map[cpu:3], got %v", limits)
+	}
+
+	if err := root.RunLine(""); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(tags, []string{"a", "b,c"}) ||
+		!reflect.DeepEqual(labels, map[string]string{"team": "core"}) ||
+		!reflect.DeepEqual(limits, map[string]int{"cpu": 1}) {
+		t.Errorf("Expected the defaults, got %v, %v, %v", tags, labels, limits)
+	}
+}
+
+// nonEmptyValue is a string flag value which cannot be set to an empty
+// string, although it is its default.
+type nonEmptyValue string
+
+func (v *nonEmptyValue) Set(s string) error {
+	if s == "" {
+		return errors.New("must not be empty")
+	}
+	*v = nonEmptyValue(s)
+	return nil
+}
+
+func (v *nonEmptyValue) String() string { return string(*v) }
+
+func (v *nonEmptyValue) Type() string { return "string" }
+
+func TestRunLineRestoresDefaultWithoutSet(t *testing.T) {
+	var mode nonEmptyValue
+	var seen []string
+	root := &Command{
+		Use: "root",
+		Run: func(*Command, []string) { seen = append(seen, string(mode)) },
+	}
+	root.Flags().Var(&mode, "mode", "")
+
+	for _, line := range []string{"--mode fast", "", ""} {
+		if err := root.RunLine(line); err != nil {
+			t.Fatalf("Unexpected error for %q: %v", line, err)
+		}
+	}
+	if expected := []string{"fast", "", ""}; !reflect.DeepEqual(seen, expected) {
+		t.Errorf("Expected the flag values %q, got %q", expected, seen)
+	}
+	if root.Flags().Changed("mode") {
+		t.Error("Expected the flag to be unchanged after the reset")
+	}
+}
+
+func TestRunLineQuotedArgs(t *testing.T) {
+	var gotArgs []string
+	root := &Command{Use: "root", Run: emptyRun}
+	echoCmd := &Command{
+		Use: "echo",
+		Run: func(_ *Command, args []string) { gotArgs = args },
+	}
+	root.AddCommand(echoCmd)
+
+	if err := root.RunLine(`echo "hello world" 'it''s'`); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"hello world", "its"}
+	if !reflect.DeepEqual(gotArgs, expected) {
+		t.Errorf("Expected args %q, got %q", expected, gotArgs)
+	}
+
+	if err := root.RunLine(`echo "unterminated`); err == nil {
+		t.Error("Expected an error for an unterminated quote")
+	}
+}
+
+func TestRunLineEmpty(t *testing.T) {
+	// An empty line must not fall back to the arguments of the program.
+	defer func(args []string) { os.Args = args }(os.Args)
+	os.Args = []string{"myshell", "sub"}
+
+	var rootArgs []string
+	rootRan, subRan := false, false
+	root := &Command{Use: "root", Run: func(_ *Command, args []string) { rootRan, rootArgs = true, args }}
+	root.AddCommand(&Command{Use: "sub", Run: func(*Command, []string) { subRan = true }})
+
+	for _, line := range []string{"", "   "} {
+		rootRan, subRan = false, false
+		if err := root.RunLine(line); err != nil {
+			t.Fatalf("Unexpected error for %q: %v", line, err)
+		}
+		if !rootRan || subRan {
+			t.Errorf("Expected %q to run the root command only, root ran: %v, sub ran: %v", line, rootRan, subRan)
+		}
+		if len(rootArgs) != 0 {
+			t.Errorf("Expected no args for %q, got %v", line, rootArgs)
+		}
+	}
+}
+
+func TestRunEOnlyCommandIsRunnable(t *testing.T) {
+	executed := false
+	root := &Command{Use: "root", Run: emptyRun}
+	childCmd := &Command{
+		Use:   "child",
+		Short: "RunE only child",
+		RunE: func(*Command, []string) error {
+			executed = true
+			return nil
+		},
+	}
+	root.AddCommand(childCmd)
+
+	if !childCmd.Runnable() {
+		t.Error("Expected a command with only RunE to be runnable")
+	}
+
+	output, err := executeCommand(root, "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "RunE only child")
+
+	if _, err := executeCommand(root, "child"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !executed {
+		t.Error("Expected RunE to be executed")
+	}
+}
+
+func TestSetHelpAsDefaultRun(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	parentCmd := &Command{Use: "parent", Short: "Parent only command", Long: "Long description of parent"}
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	parentCmd.AddCommand(childCmd)
+	root.AddCommand(parentCmd)
+
+	parentCmd.SetHelpAsDefaultRun()
+
+	output, err := executeCommand(root, "parent")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, parentCmd.Long)
+	checkStringContains(t, output, "root parent [command]")
+	checkStringContains(t, output, "child")
+}
+
+func TestSetHelpAsDefaultRunKeepsRun(t *testing.T) {
+	executed := false
+	c := &Command{Use: "c", Run: func(*Command, []string) { executed = true }}
+	c.SetHelpAsDefaultRun()
+
+	output, err := executeCommand(c)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if output != "" {
+		t.Errorf("Unexpected output: %v", output)
+	}
+	if !executed {
+		t.Error("Expected the user-provided Run to be kept")
+	}
+}
+
+func TestValidateFlagShorthands(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().StringP("output", "o", "", "")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().StringP("owner", "o", "", "")
+	root.AddCommand(childCmd)
+
+	if err := root.ValidateFlagShorthands(); err != nil {
+		t.Errorf("Unexpected error for root: %v", err)
+	}
+
+	err := childCmd.ValidateFlagShorthands()
+	if err == nil {
+		t.Fatal("Expected an error for colliding shorthands")
+	}
+	expected := `flag shorthand "-o" is used by both "owner" and "output" flags of "root child"`
+	if err.Error() != expected {
+		t.Errorf("Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestValidateFlagShorthandsOverriddenFlag(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().StringP("output", "o", "", "")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().StringP("output", "o", "", "")
+	root.AddCommand(childCmd)
+
+	if err := childCmd.ValidateFlagShorthands(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestEnableFlagShorthandValidation(t *testing.T) {
+	EnableFlagShorthandValidation = true
+	defer func() { EnableFlagShorthandValidation = false }()
+
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().StringP("output", "o", "", "")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().StringP("owner", "o", "", "")
+	root.AddCommand(childCmd)
+
+	output, err := executeCommand(root, "child")
+	if err == nil {
+		t.Fatal("Expected an error for colliding shorthands")
+	}
+	checkStringContains(t, output, `flag shorthand "-o" is used by both`)
+}
+
+func TestProgramNameFallback(t *testing.T) {
+	root := &Command{Run: emptyRun}
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	root.AddCommand(childCmd)
+
+	programName := filepath.Base(os.Args[0])
+	if got := childCmd.ProgramName(); got != programName {
+		t.Errorf("Expected program name %q, got %q", programName, got)
+	}
+
+	output, err := executeCommand(root, "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, programName+" [command]")
+
+	root.Use = "root"
+	if got := childCmd.ProgramName(); got != "root" {
+		t.Errorf("Expected program name %q, got %q", "root", got)
+	}
+}
+
+func TestHelpTemplateProgramNameAndUsageLine(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	childCmd := &Command{Use: "child [arg]", Run: emptyRun}
+	root.AddCommand(childCmd)
+	root.SetHelpTemplate(`{{.ProgramName}}|{{.UsageLine}}|{{.UseLine}}`)
+
+	output, err := executeCommand(root, "child", "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	expected := "root|root child [arg] [flags]|root child [arg] [flags]"
+	if output != expected {
+		t.Errorf("Expected %q, got %q", expected, output)
+	}
+}
+
+func TestSetUseLine(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	childCmd := &Command{Use: "root tool run [options] FILE", Run: emptyRun}
+	childCmd.Flags().Bool("force", false, "")
+	childCmd.SetUseLine("root tool run [options] FILE")
+	root.AddCommand(childCmd)
+
+	output, err := executeCommand(root, "root", "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "Usage:\n  root tool run [options] FILE\n")
+	checkStringOmits(t, output, "root root")
+	checkStringOmits(t, output, "[flags]")
+
+	if childCmd.UsageLine() != childCmd.UseLine() {
+		t.Errorf("Expected UsageLine() to match UseLine(), got %q", childCmd.UsageLine())
+	}
+}
+
+func TestFlagGroupingFunc(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.Flags().String("host", "", "server host")
+	root.Flags().Int("port", 0, "server port")
+	root.Flags().Bool("verbose", false, "verbose output")
+	root.SetFlagGroupingFunc(func(flags *pflag.FlagSet) string {
+		network := pflag.NewFlagSet("network", pflag.ContinueOnError)
+		other := pflag.NewFlagSet("other", pflag.ContinueOnError)
+		flags.VisitAll(func(f *pflag.Flag) {
+			if f.Name == "host" || f.Name == "port" {
+				network.AddFlag(f)
+			} else {
+				other.AddFlag(f)
+			}
+		})
+		return "Network:\n" + network.FlagUsages() + "Other:\n" + other.FlagUsages()
+	})
+
+	output, err := executeCommand(root, "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringOrder(t, output, "Network:", "--host", "--port", "Other:", "--help", "--verbose")
+}
+
+func TestAddFlagGroup(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().String("config", "", "config file")
+	child := &Command{Use: "child", Run: emptyRun}
+	child.Flags().String("host", "", "server host")
+	child.Flags().Int("port", 0, "server port")
+	child.Flags().StringP("output", "o", "", "output format")
+	child.Flags().Bool("verbose", false, "verbose output")
+	root.AddCommand(child)
+
+	if err := child.AddFlagGroup("Networking Flags", "host", "port"); err != nil {
+		t.Fatal(err)
+	}
+	if err := child.AddFlagGroup("Output Flags", "output"); err != nil {
+		t.Fatal(err)
+	}
+	if err := child.AddFlagGroup("Other Flags", "port"); err == nil {
+		t.Error("Expected an error adding a flag to two groups")
+	}
+	if err := child.AddFlagGroup("Other Flags", "unknown"); err == nil {
+		t.Error("Expected an error grouping an unknown flag")
+	}
+
+	output, err := executeCommand(root, "child", "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringOrder(t, output,
+		"Networking Flags:\n", "--host", "--port",
+		"Output Flags:\n", "-o, --output",
+		"\nFlags:\n", "--help", "--verbose",
+		"Global Flags:\n", "--config")
+	checkStringOmits(t, output, "Other Flags:")
+	if strings.Count(output, "--port") != 1 {
+		t.Errorf("Expected --port to be listed once, got:\n%s", output)
+	}
+}
+
+func TestHelpFlagOrder(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.SetGlobalNormalizationFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		return pflag.NormalizedName(strings.Replace(name, "_", "-", -1))
+	})
+	root.PersistentFlags().String("zeta", "", "")
+	root.PersistentFlags().String("alpha_root", "", "")
+	root.PersistentFlags().String("mid", "", "")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().String("yankee", "", "")
+	childCmd.PersistentFlags().String("bravo", "", "")
+	childCmd.Flags().String("x_ray", "", "")
+	root.AddCommand(childCmd)
+
+	for i := 0; i < 2; i++ {
+		output, err := executeCommand(root, "child", "--help")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		checkStringOrder(t, output, "--bravo", "--help", "--x-ray", "--yankee", "Global Flags:", "--alpha-root", "--mid", "--zeta")
+	}
+}
+
+func TestSetSortFlags(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.SetSortFlags(false)
+	root.PersistentFlags().String("zeta", "", "")
+	root.PersistentFlags().String("alpha", "", "")
+	root.PersistentFlags().String("mid", "", "")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().String("yankee", "", "")
+	childCmd.PersistentFlags().String("bravo", "", "")
+	childCmd.Flags().String("xray", "", "")
+	root.AddCommand(childCmd)
+
+	output, err := executeCommand(root, "child", "--help")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkStringOrder(t, output, "--yankee", "--xray", "--bravo", "--help", "Global Flags:", "--zeta", "--alpha", "--mid")
+
+	childCmd.SetSortFlags(true)
+	output, err = executeCommand(root, "child", "--help")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkStringOrder(t, output, "--bravo", "--help", "--xray", "--yankee", "Global Flags:", "--alpha", "--mid", "--zeta")
+
+	childCmd.SetSortFlags(false)
+	output, err = executeCommand(root, "child", "--help")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkStringOrder(t, output, "--yankee", "--xray", "--bravo", "--help", "Global Flags:", "--zeta", "--alpha", "--mid")
+
+	for _, flags := range []*pflag.FlagSet{root.PersistentFlags(), childCmd.Flags(), childCmd.PersistentFlags()} {
+		if !flags.SortFlags {
+			t.Error("Expected the SortFlags of the flag sets of the commands to be left unchanged")
+		}
+	}
+
+}
+
+func TestSetSortFlagsAfterSortedUsage(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().String("zeta", "", "")
+	root.PersistentFlags().String("alpha", "", "")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().String("yankee", "", "")
+	childCmd.Flags().String("xray", "", "")
+	root.AddCommand(childCmd)
+
+	output, err := executeCommand(root, "child", "--help")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkStringOrder(t, output, "--help", "--xray", "--yankee", "Global Flags:", "--alpha", "--zeta")
+
+	root.SetSortFlags(false)
+	output, err = executeCommand(root, "child", "--help")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkStringOrder(t, output, "--yankee", "--xray", "--help", "Global Flags:", "--zeta", "--alpha")
+}
+
+// checkStringOrder checks that all the given strings are found in s in the
+// given order.
+func checkStringOrder(t *testing.T, s string, expected ...string) {
+	prev := -1
+	for i, e := range expected {
+		index := strings.Index(s, e)
+		if index < 0 {
+			t.Errorf("Expected to contain %q, got:\n%s", e, s)
+			return
+		}
+		if index < prev {
+			t.Errorf("Expected %q to be listed after %q, got:\n%s", e, expected[i-1], s)
+			return
+		}
+		prev = index
+	}
+}
+
+func TestHelpTemplateLocalAndInheritedFlags(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().String("config", "", "config file")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().Bool("force", false, "force it")
+	root.AddCommand(childCmd)
+	root.SetHelpTemplate(`{{if .HasAvailableLocalFlags}}local:{{.LocalFlags.FlagUsages}}{{end}}` +
+		`{{if .HasAvailableInheritedFlags}}inherited:{{.InheritedFlags.FlagUsages}}{{end}}`)
+
+	output, err := executeCommand(root, "child", "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	index := strings.Index(output, "inherited:")
+	if !strings.HasPrefix(output, "local:") || index < 0 {
+		t.Fatalf("Expected local and inherited sections, got:\n%s", output)
+	}
+	checkStringContains(t, output[:index], "--force")
+	checkStringContains(t, output[:index], "--help")
+	checkStringOmits(t, output[:index], "--config")
+	checkStringContains(t, output[index:], "--config")
+	checkStringOmits(t, output[index:], "--force")
+}
+
+func TestHasAvailableExcludesHiddenAndDeprecated(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().String("old", "", "")
+	root.PersistentFlags().MarkDeprecated("old", "use --new instead")
+	childCmd := &Command{Use: "child", Hidden: true, Run: emptyRun}
+	childCmd.Flags().String("secret", "", "")
+	childCmd.Flags().MarkHidden("secret")
+	root.AddCommand(childCmd)
+
+	if !root.HasSubCommands() {
+		t.Error("Expected root to have sub commands")
+	}
+	if root.HasAvailableSubCommands() {
+		t.Error("Expected root to have no available sub commands when its only one is hidden")
+	}
+	if root.HasAvailablePersistentFlags() {
+		t.Error("Expected root to have no available persistent flags when its only one is deprecated")
+	}
+	if childCmd.HasAvailableInheritedFlags() {
+		t.Error("Expected child to have no available inherited flags")
+	}
+	childCmd.InitDefaultHelpFlag()
+	childCmd.Flags().MarkHidden("help")
+	if childCmd.HasAvailableFlags() {
+		t.Error("Expected child to have no available flags when they are all hidden")
+	}
+
+	output, err := executeCommand(root, "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringOmits(t, output, "Available Commands:")
+	checkStringOmits(t, output, "Global Flags:")
+}
+
+type notFoundError struct{}
+
+func (notFoundError) Error() string { return "not found" }
+
+func TestExecuteAndExit(t *testing.T) {
+	var code int
+	defer func(exit func(int)) { osExit = exit }(osExit)
+	osExit = func(c int) { code = c }
+
+	root := &Command{Use: "root", Run: emptyRun}
+	childCmd := &Command{
+		Use:  "child",
+		RunE: func(*Command, []string) error { return notFoundError{} },
+	}
+	root.AddCommand(childCmd)
+	root.SetExitCodeFunc(func(err error) int {
+		if _, ok := err.(notFoundError); ok {
+			return 2
+		}
+		return 1
+	})
+	buf := new(bytes.Buffer)
+	root.SetOut(buf)
+	root.SetErr(buf)
+
+	root.SetArgs([]string{"child"})
+	root.ExecuteAndExit()
+	if code != 2 {
+		t.Errorf("Expected exit code 2, got %d", code)
+	}
+	checkStringContains(t, buf.String(), "Error: not found")
+
+	root.SetExitCodeFunc(func(error) int { return 1 })
+	code = -1
+	root.SetArgs([]string{})
+	root.ExecuteAndExit()
+	if code != 0 {
+		t.Errorf("Expected exit code 0 on success, got %d", code)
+	}
+
+	root.SetExitCodeFunc(nil)
+	for args, expected := range map[string]int{"": 0, "unknown": 1, "child": 1} {
+		code = -1
+		root.SetArgs(strings.Fields(args))
+		root.ExecuteAndExit()
+		if code != expected {
+			t.Errorf("Expected exit code %d for %q, got %d", expected, args, code)
+		}
+	}
+}
+
+func TestResetFlagsRecursive(t *testing.T) {
+	var (
+		verbose bool
+		name    string
+		labels  []string
+	)
+	root := &Command{Use: "root", Run: emptyRun}
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	grandchildCmd := &Command{Use: "grandchild", Run: emptyRun}
+	childCmd.AddCommand(grandchildCmd)
+	root.AddCommand(childCmd)
+	defineFlags := func() {
+		root.PersistentFlags().BoolVar(&verbose, "verbose", false, "")
+		childCmd.Flags().StringVar(&name, "name", "default", "")
+		grandchildCmd.Flags().StringSliceVar(&labels, "labels", []string{"a"}, "")
+	}
+	defineFlags()
+
+	for _, args := range [][]string{
+		{"child", "--verbose", "--name", "other"},
+		{"child", "grandchild", "--labels", "b,c"},
+	} {
+		if _, err := executeCommand(root, args...); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	if err := root.ResetFlagsRecursive(true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if verbose || name != "default" || !reflect.DeepEqual(labels, []string{"a"}) {
+		t.Errorf("Expected variables to be restored to their defaults, got %v, %q, %v", verbose, name, labels)
+	}
+	for _, cmd := range []*Command{root, childCmd, grandchildCmd} {
+		if cmd.HasFlags() || cmd.HasPersistentFlags() {
+			t.Errorf("Expected %q to have no flags", cmd.Name())
+		}
+	}
+
+	defineFlags()
+	if _, err := executeCommand(root, "child", "grandchild"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if verbose || name != "default" || !reflect.DeepEqual(labels, []string{"a"}) {
+		t.Errorf("Expected flags to have their defaults, got %v, %q, %v", verbose, name, labels)
+	}
+	for _, flagName := range []string{"verbose", "labels"} {
+		if grandchildCmd.Flag(flagName).Changed {
+			t.Errorf("Expected %q not to be changed", flagName)
+		}
+	}
+}
+
+func TestUseLineWithRequiredFlags(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().String("token", "", "API `TOKEN`")
+	root.MarkPersistentFlagRequired("token")
+	childCmd := &Command{Use: "create NAME", Run: emptyRun}
+	childCmd.Flags().Int("size", 0, "")
+	childCmd.Flags().Bool("force", false, "")
+	childCmd.Flags().String("region", "", "")
+	childCmd.MarkFlagRequired("size")
+	childCmd.MarkFlagRequired("force")
+	root.AddCommand(childCmd)
+	root.SetUsageTemplate("{{.UseLineWithRequiredFlags}}\n")
+
+	output, err := executeCommand(root, "create", "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	expected := "root create NAME --force --size int --token TOKEN [flags]\n"
+	if output != expected {
+		t.Errorf("Expected %q, got %q", expected, output)
+	}
+
+	childCmd.DisableFlagsInUseLine = true
+	expected = "root create NAME --force --size int --token TOKEN"
+	if got := childCmd.UseLineWithRequiredFlags(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestHelpFlagDefaults(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.Flags().Bool("force", false, "force it")
+	root.Flags().Bool("color", true, "use colors")
+	root.Flags().String("name", "", "the name")
+	root.Flags().String("mode", "x", "the mode")
+	root.Flags().Int("retries", 0, "the retries")
+
+	output, err := executeCommand(root, "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "--force         force it\n")
+	checkStringContains(t, output, "--color         use colors (default true)\n")
+	checkStringContains(t, output, "--name string   the name\n")
+	checkStringContains(t, output, "--mode string   the mode (default \"x\")\n")
+	checkStringContains(t, output, "--retries int   the retries\n")
+}
+
+func TestGlobalFlags(t *testing.T) {
+	var config string
+	root := &Command{Use: "root", Run: emptyRun}
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	grandchildCmd := &Command{Use: "grandchild", Run: emptyRun}
+	childCmd.AddCommand(grandchildCmd)
+	root.AddCommand(childCmd)
+	grandchildCmd.GlobalFlags().StringVar(&config, "config", "", "config file")
+
+	if root.PersistentFlags().Lookup("config") == nil {
+		t.Fatal("Expected global flags to be the persistent flags of root")
+	}
+
+	for expected, args := range map[string][]string{
+		"before.yaml":  {"--config", "before.yaml", "child", "grandchild"},
+		"between.yaml": {"child", "--config", "between.yaml", "grandchild"},
+		"after.yaml":   {"child", "grandchild", "--config", "after.yaml"},
+	} {
+		config = ""
+		if _, err := executeCommand(root, args...); err != nil {
+			t.Fatalf("Unexpected error for %v: %v", args, err)
+		}
+		if config != expected {
+			t.Errorf("Expected config %q for %v, got %q", expected, args, config)
+		}
+	}
+}
+
+func TestAddCommandClone(t *testing.T) {
+	var called []string
+	versionCmd := &Command{
+		Use: "version",
+		Run: func(c *Command, _ []string) { called = append(called, c.CommandPath()) },
+	}
+	versionCmd.Flags().Bool("short", false, "")
+
+	root := &Command{Use: "root", Run: emptyRun}
+	serverCmd := &Command{Use: "server", Run: emptyRun}
+	clientCmd := &Command{Use: "client", Run: emptyRun}
+	root.AddCommand(serverCmd, clientCmd)
+
+	serverVersion := serverCmd.AddCommandClone(versionCmd)
+	clientVersion := clientCmd.AddCommandClone(versionCmd)
+
+	if serverVersion == versionCmd || clientVersion == versionCmd || serverVersion == clientVersion {
+		t.Fatal("Expected independent copies of the command")
+	}
+	if versionCmd.HasParent() {
+		t.Error("Expected the original command to be left without a parent")
+	}
+	if got := serverVersion.CommandPath(); got != "root server version" {
+		t.Errorf("Expected command path %q, got %q", "root server version", got)
+	}
+	if got := clientVersion.CommandPath(); got != "root client version" {
+		t.Errorf("Expected command path %q, got %q", "root client version", got)
+	}
+
+	for _, args := range [][]string{{"server", "version", "--short"}, {"client", "version"}} {
+		if _, err := executeCommand(root, args...); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	expected := []string{"root server version", "root client version"}
+	if !reflect.DeepEqual(called, expected) {
+		t.Errorf("Expected calls %v, got %v", expected, called)
+	}
+}
+
+func TestAddCommandCloneLocalFlagShadowingInheritedFlag(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().String("output", "", "")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().Int("output", 0, "")
+	root.AddCommand(childCmd)
+	childCmd.InheritedFlags()
+
+	other := &Command{Use: "other", Run: emptyRun}
+	clone := other.AddCommandClone(childCmd)
+
+	f := clone.Flags().Lookup("output")
+	if f == nil {
+		t.Fatal("Expected the local flag shadowing an inherited flag to be copied")
+	}
+	if f.Value.Type() != "int" {
+		t.Errorf("Expected the copied flag to be the local int flag, got a %s flag", f.Value.Type())
+	}
+}
+
+func TestDeepCopy(t *testing.T) {
+	var verbose bool
+	root := &Command{Use: "root", Aliases: []string{"r"}, Annotations: map[string]string{"k": "v"}, Run: emptyRun}
+	root.PersistentFlags().BoolVar(&verbose, "verbose", false, "")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().String("name", "", "")
+	grandchildCmd := &Command{Use: "grandchild", Run: emptyRun}
+	childCmd.AddCommand(grandchildCmd)
+	root.AddCommand(childCmd)
+
+	clone := root.DeepCopy()
+
+	if len(clone.Commands()) != 1 {
+		t.Fatalf("Expected 1 sub command, got %d", len(clone.Commands()))
+	}
+	childClone := clone.Commands()[0]
+	if childClone == childCmd || childClone.Parent() != clone {
+		t.Error("Expected the sub command to be copied with the copy as parent")
+	}
+	grandchildClone := childClone.Commands()[0]
+	if grandchildClone == grandchildCmd || grandchildClone.Parent() != childClone {
+		t.Error("Expected the nested sub command to be copied with the copied child as parent")
+	}
+	if got := grandchildClone.CommandPath(); got != "root child grandchild" {
+		t.Errorf("Expected command path %q, got %q", "root child grandchild", got)
+	}
+
+	clone.AddCommand(&Command{Use: "extra", Run: emptyRun})
+	childClone.AddCommand(&Command{Use: "extra", Run: emptyRun})
+	clone.Aliases[0] = "changed"
+	clone.Annotations["k"] = "changed"
+	if len(root.Commands()) != 1 || len(childCmd.Commands()) != 1 {
+		t.Error("Expected the commands of the original tree to be left unchanged")
+	}
+	if root.Aliases[0] != "r" || root.Annotations["k"] != "v" {
+		t.Error("Expected the aliases and annotations of the original to be left unchanged")
+	}
+
+	if childClone.Flags().Lookup("name") == childCmd.Flags().Lookup("name") {
+		t.Error("Expected the flag definitions to be copied")
+	}
+	if _, err := executeCommand(clone, "child", "grandchild", "--verbose"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !verbose {
+		t.Error("Expected the copied flag to be bound to the same variable")
+	}
+	if root.PersistentFlags().Lookup("verbose").Changed {
+		t.Error("Expected the original flag to be left unchanged")
+	}
+}
+
+func TestPrintFollowsParentOutput(t *testing.T) {
+	childCmd := &Command{Use: "child", Run: emptyRun}
+
+	// A detached command prints to stderr without a panic
+	stderr := os.Stderr
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stderr = w
+	childCmd.Println("detached")
+	childCmd.Printf("%s\n", "formatted")
+	os.Stderr = stderr
+	w.Close()
+	out, _ := ioutil.ReadAll(r)
+	if string(out) != "detached\nformatted\n" {
+		t.Errorf("Expected the output on stderr, got %q", out)
+	}
+
+	// The output is looked up when printing, so that it follows the parents
+	// the command is attached to and the writers they are given afterwards.
+	firstBuf, secondBuf := new(bytes.Buffer), new(bytes.Buffer)
+	first := &Command{Use: "first"}
+	second := &Command{Use: "second"}
+	first.AddCommand(childCmd)
+	first.SetOut(firstBuf)
+	childCmd.Print("one")
+	first.RemoveCommand(childCmd)
+	second.AddCommand(childCmd)
+	second.SetOut(secondBuf)
+	childCmd.Print("two")
+
+	if firstBuf.String() != "one" || secondBuf.String() != "two" {
+		t.Errorf("Expected the output of the current parent to be used, got %q and %q", firstBuf.String(), secondBuf.String())
+	}
+}
+
+func TestPersistentFlagRedefinedInSubtree(t *testing.T) {
+	var rootRetries, midRetries int
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().IntVar(&rootRetries, "retries", 1, "")
+	midCmd := &Command{Use: "mid", Run: emptyRun}
+	midCmd.PersistentFlags().IntVar(&midRetries, "retries", 5, "")
+	leafCmd := &Command{Use: "leaf", Run: emptyRun}
+	otherCmd := &Command{Use: "other", Run: emptyRun}
+	midCmd.AddCommand(leafCmd)
+	root.AddCommand(midCmd, otherCmd)
+
+	if _, err := executeCommand(root, "mid", "leaf"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := leafCmd.Flag("retries").DefValue; got != "5" {
+		t.Errorf("Expected leaf to see the default of mid, got %q", got)
+	}
+	if got := leafCmd.InheritedFlags().Lookup("retries"); got != midCmd.PersistentFlags().Lookup("retries") {
+		t.Error("Expected leaf to inherit the flag of mid")
+	}
+
+	if _, err := executeCommand(root, "mid", "leaf", "--retries", "7"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if midRetries != 7 || rootRetries != 1 {
+		t.Errorf("Expected only the flag of mid to be set, got root %d and mid %d", rootRetries, midRetries)
+	}
+
+	if _, err := executeCommand(root, "other", "--retries", "3"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rootRetries != 3 || midRetries != 7 {
+		t.Errorf("Expected the flag of root to apply outside of mid, got root %d and mid %d", rootRetries, midRetries)
+	}
+}
+
+func TestErrorHook(t *testing.T) {
+	type failure struct {
+		cmd  string
+		args []string
+		err  string
+	}
+	var failures []failure
+	root := &Command{Use: "root", Run: emptyRun}
+	childCmd := &Command{Use: "child", Args: ExactArgs(1), Run: emptyRun}
+	childCmd.Flags().String("name", "", "")
+	childCmd.MarkFlagRequired("name")
+	failingCmd := &Command{
+		Use:  "failing",
+		RunE: func(*Command, []string) error { return errors.New("run failed") },
+	}
+	root.AddCommand(childCmd, failingCmd)
+	root.SetErrorHook(func(cmd *Command, args []string, err error) {
+		failures = append(failures, failure{cmd.Name(), args, err.Error()})
+	})
+
+	for _, args := range [][]string{
+		{"unknown"},
+		{"child", "--unknown"},
+		{"child", "arg"},
+		{"child", "--name", "n"},
+		{"child", "arg", "--name", "n"},
+		{"failing"},
+	} {
+		executeCommand(root, args...)
+	}
+
+	expected := []failure{
+		{"root", []string{"unknown"}, `unknown command "unknown" for "root"`},
+		{"child", []string{"--unknown"}, "unknown flag: --unknown"},
+		{"child", []string{"arg"}, `required flag(s) "name" not set`},
+		{"child", []string{"--name", "n"}, "accepts 1 arg(s), received 0"},
+	}
+	if !reflect.DeepEqual(failures, expected) {
+		t.Errorf("Expected failures %v, got %v", expected, failures)
+	}
+}
+
+func TestResolveOnly(t *testing.T) {
+	var called bool
+	run := func(*Command, []string) { called = true }
+	root := &Command{Use: "root", PersistentPreRun: run, Run: run}
+	root.PersistentFlags().Bool("verbose", false, "")
+	childCmd := &Command{Use: "child", Run: run}
+	leafCmd := &Command{Use: "leaf", Args: NoArgs, PreRun: run, Run: run}
+	leafCmd.Flags().StringP("zone", "z", "", "")
+	childCmd.AddCommand(leafCmd)
+	root.AddCommand(childCmd)
+
+	cmd, args, err := childCmd.ResolveOnly([]string{"child", "leaf", "x", "-z", "eu", "y", "--verbose"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cmd != leafCmd {
+		t.Errorf("Expected the leaf command, got %q", cmd.Name())
+	}
+	if expected := []string{"x", "y"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected args %v, got %v", expected, args)
+	}
+	if zone, _ := cmd.Flags().GetString("zone"); zone != "eu" {
+		t.Errorf("Expected the flags to be parsed, got zone %q", zone)
+	}
+	if called {
+		t.Error("Expected no hook or Run to be called")
+	}
+
+	if _, _, err := root.ResolveOnly([]string{"child", "leaf", "--unknown"}); err == nil {
+		t.Error("Expected an error for an unknown flag")
+	}
+}
+
+func TestHelpExampleIndentation(t *testing.T) {
+	example := `
+
+    root --flag value
+    root --multi \
+        --other value
+
+    root last
+`
+	root := &Command{Use: "root", Example: example, Run: emptyRun}
+
+	output, err := executeCommand(root, "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, `Examples:
+  root --flag value
+  root --multi \
+      --other value
+
+  root last
+
+Flags:`)
+	if root.Example != example {
+		t.Error("Expected the Example field to be left unchanged")
+	}
+
+	root.Example = "root first\n\troot second"
+	output, err = executeCommand(root, "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "Examples:\n  root first\n  \troot second\n")
+}
+
+func TestValidationModeAllErrors(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	childCmd := &Command{Use: "child", Args: NoArgs, Run: emptyRun}
+	childCmd.Flags().String("user", "", "")
+	childCmd.Flags().String("password", "", "")
+	childCmd.Flags().Bool("json", false, "")
+	childCmd.Flags().Bool("yaml", false, "")
+	childCmd.MarkFlagRequired("user")
+	childCmd.MarkFlagRequired("password")
+	childCmd.MarkFlagsMutuallyExclusive("json", "yaml")
+	root.AddCommand(childCmd)
+
+	_, err := executeCommand(root, "child", "--json", "--yaml")
+	if err == nil || err.Error() != `required flag(s) "password", "user" not set` {
+		t.Errorf("Expected only the first error by default, got %v", err)
+	}
+
+	root.SetValidationMode(AllErrors)
+	_, err = executeCommand(root, "child", "--json", "--yaml", "extra")
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	expected := strings.Join([]string{
+		`unknown command "extra" for "root child"`,
+		`required flag(s) "password", "user" not set`,
+		"if any flags in the group [json yaml] are set none of the others can be; [json yaml] were all set",
+	}, "\n")
+	if err.Error() != expected {
+		t.Errorf("Expected error:\n%s\nGot:\n%s", expected, err.Error())
+	}
+}
+
+func TestValidationModeAllErrorsReportsEveryFlagError(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.Flags().String("user", "", "")
+	root.Flags().String("token", "", "")
+	root.Flags().Bool("json", false, "")
+	root.Flags().Bool("yaml", false, "")
+	root.Flags().Bool("quiet", false, "")
+	root.Flags().Bool("verbose", false, "")
+	root.MarkFlagRequired("user")
+	root.MarkFlagRequiredNonEmpty("token")
+	root.MarkFlagsMutuallyExclusive("json", "yaml")
+	root.MarkFlagsMutuallyExclusive("quiet", "verbose")
+	root.SetValidationMode(AllErrors)
+
+	_, err := executeCommand(root, "--token=", "--json", "--yaml", "--quiet", "--verbose")
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	expected := strings.Join([]string{
+		`required flag(s) "user" not set`,
+		`required flag(s) "token" set to an empty value`,
+		"if any flags in the group [json yaml] are set none of the others can be; [json yaml] were all set",
+		"if any flags in the group [quiet verbose] are set none of the others can be; [quiet verbose] were all set",
+	}, "\n")
+	if err.Error() != expected {
+		t.Errorf("Expected error:\n%s\nGot:\n%s", expected, err.Error())
+	}
+
+	var verrs validationErrors
+	if !errors.As(err, &verrs) || len(verrs) != 4 {
+		t.Errorf("Expected the 4 errors to be kept apart, got %#v", err)
+	}
+
+	sentinel := errors.New("bad argument")
+	root.Args = func(*Command, []string) error { return sentinel }
+	_, err = executeCommand(root, "--token=")
+	if !errors.Is(err, sentinel) {
+		t.Errorf("Expected errors.Is to match the argument error, got %v", err)
+	}
+}
+
+func TestUsageStringDoesNotWriteToOutput(t *testing.T) {
+	c := &Command{Use: "c [args]", Run: emptyRun}
+	c.Flags().String("name", "", "the name to use")
+
+	buf := new(bytes.Buffer)
+	c.SetOut(buf)
+	c.SetErr(buf)
+
+	usage := c.UsageString()
+	checkStringContains(t, usage, c.UseLine())
+	checkStringContains(t, usage, "Flags:\n      --name string   the name to use")
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing written to the output, got %q", buf.String())
+	}
+	if c.OutOrStdout() != buf || c.ErrOrStderr() != buf {
+		t.Error("Expected the output writers to be restored")
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	c := &Command{Use: "c", Run: emptyRun}
+	if _, ok := c.Annotation("auth"); ok {
+		t.Error("Expected no annotation on a new command")
+	}
+
+	c.SetAnnotation("auth", "required")
+	if value, ok := c.Annotation("auth"); !ok || value != "required" {
+		t.Errorf("Expected annotation %q, got %q (set: %v)", "required", value, ok)
+	}
+	if c.Annotations["auth"] != "required" {
+		t.Error("Expected the annotation in the Annotations field")
+	}
+}
+
+func TestFlagsConcurrentInitialization(t *testing.T) {
+	c := &Command{Use: "c", Run: emptyRun}
+
+	const n = 50
+	flagSets := make(chan *pflag.FlagSet, 2*n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			flagSets <- c.Flags()
+		}()
+		go func() {
+			defer wg.Done()
+			flagSets <- c.PersistentFlags()
+		}()
+	}
+	wg.Wait()
+	close(flagSets)
+
+	for fs := range flagSets {
+		if fs != c.Flags() && fs != c.PersistentFlags() {
+			t.Fatal("Expected all goroutines to get the same flag sets")
+		}
+	}
+}
+
+func TestAddCommandCycle(t *testing.T) {
+	aCmd := &Command{Use: "a", Run: emptyRun}
+	bCmd := &Command{Use: "b", Run: emptyRun}
+	cCmd := &Command{Use: "c", Run: emptyRun}
+	aCmd.AddCommand(bCmd)
+	bCmd.AddCommand(cCmd)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected a panic when adding an ancestor as a child")
+			}
+		}()
+		cCmd.AddCommand(aCmd)
+	}()
+
+	if aCmd.HasParent() {
+		t.Error("Expected the ancestor to be left without a parent")
+	}
+	if got := cCmd.CommandPath(); got != "a b c" {
+		t.Errorf("Expected command path %q, got %q", "a b c", got)
+	}
+	if _, err := executeCommand(aCmd, "b", "c"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestSetCommandColumnWidth(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	rootCmd.AddCommand(
+		&Command{Use: "get", Short: "Get things", Run: emptyRun},
+		&Command{Use: "describe", Short: "Describe things", Run: emptyRun},
+	)
+	rootCmd.SetCommandColumnWidth(20)
+
+	output, err := executeCommand(rootCmd, "--help")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "\n  get                  Get things\n")
+	checkStringContains(t, output, "\n  describe             Describe things\n")
+
+	rootCmd.SetCommandColumnWidth(0)
+	output, err = executeCommand(rootCmd, "--help")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "\n  get         Get things\n")
+}
+
+func TestExecuteWithStats(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	rootCmd.PersistentFlags().Bool("verbose", false, "")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().String("name", "", "")
+	rootCmd.AddCommand(childCmd)
+
+	rootCmd.SetArgs([]string{"child", "--verbose", "--name", "foo"})
+	stats, err := rootCmd.ExecuteWithStats()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := (ExecStats{Commands: 2, FlagsChanged: 2}); stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+
+	rootCmd.SetOut(new(bytes.Buffer))
+	rootCmd.SetArgs([]string{"child", "--help"})
+	stats, err = rootCmd.ExecuteWithStats()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !stats.ShortCircuited {
+		t.Errorf("Expected the help flag to short-circuit the execution, got %+v", stats)
+	}
+}
+
+func TestDisableHelpFlag(t *testing.T) {
+	var gotArgs []string
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	completionCmd := &Command{
+		Use:                "completion",
+		DisableFlagParsing: true,
+		DisableHelpFlag:    true,
+		Run:                func(_ *Command, args []string) { gotArgs = args },
+	}
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	rootCmd.AddCommand(completionCmd, childCmd)
+
+	output, err := executeCommand(rootCmd, "completion", "--help", "help")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if output != "" {
+		t.Errorf("Expected no output, got %q", output)
+	}
+	if expected := []string{"--help", "help"}; !reflect.DeepEqual(gotArgs, expected) {
+		t.Errorf("Expected args %v, got %v", expected, gotArgs)
+	}
+	if completionCmd.Flags().Lookup("help") != nil {
+		t.Error("Expected no help flag on the command")
+	}
+
+	output, err = executeCommand(rootCmd, "child", "--help")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "-h, --help   help for child")
+}
+
+func TestDisableHelpFlagWithFlagParsing(t *testing.T) {
+	ran := false
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	childCmd := &Command{
+		Use:             "child",
+		Short:           "The child",
+		DisableHelpFlag: true,
+		Run:             func(*Command, []string) { ran = true },
+	}
+	rootCmd.AddCommand(childCmd)
+
+	// Without a flag of its own, --help and -h still show the help
+	for _, arg := range []string{"--help", "-h"} {
+		output, err := executeCommand(rootCmd, "child", arg)
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", arg, err)
+		}
+		if ran {
+			t.Errorf("Expected %s not to run the command", arg)
+		}
+		checkStringContains(t, output, "The child")
+		checkStringOmits(t, output, "help for child")
+	}
+	if childCmd.Flags().Lookup("help") != nil {
+		t.Error("Expected no help flag on the command")
+	}
+
+	// A help flag of the command is parsed as any other flag
+	var help bool
+	childCmd.Flags().BoolVar(&help, "help", false, "custom help")
+	if _, err := executeCommand(rootCmd, "child", "--help"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !ran || !help {
+		t.Errorf("Expected the command to run with its own help flag set, ran: %v, help: %v", ran, help)
+	}
+}
+
+func TestArgFileExpansion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cobra-args")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	argsFile := filepath.Join(dir, "args.txt")
+	if err := ioutil.WriteFile(argsFile, []byte("--name 'big widget'\n--count 3 first\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var gotArgs []string
+	var name string
+	var count int
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	childCmd := &Command{Use: "child", Run: func(_ *Command, args []string) { gotArgs = args }}
+	childCmd.Flags().StringVar(&name, "name", "", "")
+	childCmd.Flags().IntVar(&count, "count", 0, "")
+	rootCmd.AddCommand(childCmd)
+	rootCmd.SetArgFileExpansion(true)
+
+	if _, err := executeCommand(rootCmd, "child", "@"+argsFile, "@@literal", "last"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if name != "big widget" || count != 3 {
+		t.Errorf("Expected name %q and count 3, got %q and %d", "big widget", name, count)
+	}
+	if expected := []string{"first", "@literal", "last"}; !reflect.DeepEqual(gotArgs, expected) {
+		t.Errorf("Expected args %v, got %v", expected, gotArgs)
+	}
+
+	missing := filepath.Join(dir, "missing.txt")
+	_, err = executeCommand(rootCmd, "child", "@"+missing)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("cannot read arguments from %q", missing)) {
+		t.Errorf("Expected an error for the missing file, got %v", err)
+	}
+
+	// ResolveOnly prepares the arguments the same way.
+	name, count = "", 0
+	cmd, args, err := rootCmd.ResolveOnly([]string{"child", "@" + argsFile})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cmd != childCmd || name != "big widget" || count != 3 || !reflect.DeepEqual(args, []string{"first"}) {
+		t.Errorf("Expected the file to be expanded, got %q, %q, %d, %v", cmd.Name(), name, count, args)
+	}
+
+	// A word being completed is not a file to read.
+	childCmd.ValidArgs = []string{"@scope", "other"}
+	output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, "child", "@sc")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "@scope\n")
+}
+
+func TestExampleTemplate(t *testing.T) {
+	rootCmd := &Command{Use: "myapp", Run: emptyRun}
+	getCmd := &Command{
+		Use:     "get",
+		Example: "  {{.ProgramName}} get widget\n  {{.CommandPath}} gadget",
+		Run:     emptyRun,
+	}
+	brokenCmd := &Command{Use: "broken", Example: "  myapp broken {{oops", Run: emptyRun}
+	rootCmd.AddCommand(getCmd, brokenCmd)
+
+	// Examples are not templates by default
+	output, err := executeCommand(rootCmd, "get", "--help")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "Examples:\n  {{.ProgramName}} get widget\n")
+
+	rootCmd.SetExampleTemplating(true)
+	output, err = executeCommand(rootCmd, "get", "--help")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "Examples:\n  myapp get widget\n  myapp get gadget\n")
+
+	output, err = executeCommand(rootCmd, "broken", "--help")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "Examples:\n  myapp broken {{oops\n")
+}
+
+func TestDebugTree(t *testing.T) {
+	rootCmd := &Command{Use: "mycmd", Run: emptyRun}
+	sub1 := &Command{Use: "sub1", Aliases: []string{"s1"}}
+	sub1.AddCommand(
+		&Command{Use: "sub1sub1", Run: emptyRun},
+		&Command{Use: "secret", Run: emptyRun, Hidden: true},
+	)
+	sub2 := &Command{Use: "sub2", Run: emptyRun, Deprecated: "use sub1"}
+	rootCmd.AddCommand(sub1, sub2)
+
+	buf := new(bytes.Buffer)
+	rootCmd.DebugTree(buf)
+
+	expected := `mycmd [R]
+  sub1 (aliases: s1)
+    secret [R] [H]
+    sub1sub1 [R]
+  sub2 [R] [D]
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, buf.String())
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/spf13/cobra/internal/flagspec"
 	"github.com/spf13/pflag"
 )
 
@@ -76,6 +77,67 @@ func (c *Command) RegisterFlagCompletionFunc(flagName string, f func(cmd *Comman
 	return nil
 }
 
+// RegisterDefaultFlagCompletionFunc registers a function to provide completion for any flag
+// named flagName of this command or of its children. It is used for flags that have no
+// completion function registered with RegisterFlagCompletionFunc, which takes precedence.
+// This is useful for flags, such as --output, that are repeated across many commands.
+func (c *Command) RegisterDefaultFlagCompletionFunc(flagName string, f func(cmd *Command, args []string, toComplete string) ([]string, ShellCompDirective)) error {
+	if _, exists := c.defaultFlagCompletionFuncs[flagName]; exists {
+		return fmt.Errorf("RegisterDefaultFlagCompletionFunc: flag '%s' already registered", flagName)
+	}
+	if c.defaultFlagCompletionFuncs == nil {
+		c.defaultFlagCompletionFuncs = map[string]func(cmd *Command, args []string, toComplete string) ([]string, ShellCompDirective){}
+	}
+	c.defaultFlagCompletionFuncs[flagName] = f
+	return nil
+}
+
+// noFileCompFlagTypes are the types of the pflag values which are never
+// files, such as numbers, durations, IP addresses or key=value pairs. File
+// completion is disabled for the flags of these types by default, and no
+// other value is suggested for them.
+var noFileCompFlagTypes = map[string]bool{
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true, "count": true, "duration": true,
+	"ip": true, "ipMask": true, "ipNet": true, "bytesHex": true, "bytesBase64": true,
+	"intSlice": true, "int32Slice": true, "int64Slice": true, "uintSlice": true,
+	"float32Slice": true, "float64Slice": true, "durationSlice": true, "ipSlice": true,
+	"stringToString": true, "stringToInt": true, "stringToInt64": true,
+}
+
+// flagCompletionFunc returns the completion function of the given flag of c:
+// either the one registered for the flag itself or the default one registered
+// for its name by c or the closest parent. Flags without a registered
+// function complete the values of their BashCompValidValues annotation or,
+// for enum flags, their allowed values.
+func (c *Command) flagCompletionFunc(flag *pflag.Flag) func(cmd *Command, args []string, toComplete string) ([]string, ShellCompDirective) {
+	if f, exists := flagCompletionFunctions[flag]; exists {
+		return f
+	}
+	for p := c; p != nil; p = p.Parent() {
+		if f, exists := p.defaultFlagCompletionFuncs[flag.Name]; exists {
+			return f
+		}
+	}
+	values, present := flag.Annotations[BashCompValidValues]
+	if e, ok := flag.Value.(*enumValue); ok && !present {
+		values, present = e.allowed, true
+	}
+	if present {
+		return func(cmd *Command, args []string, toComplete string) ([]string, ShellCompDirective) {
+			var comps []string
+			for _, v := range values {
+				if strings.HasPrefix(v, toComplete) {
+					comps = append(comps, v)
+				}
+			}
+			return comps, ShellCompDirectiveNoFileComp
+		}
+	}
+	return nil
+}
+
 // Returns a string listing the different directive enabled in the specified parameter
 func (d ShellCompDirective) string() string {
 	var directives []string
@@ -249,8 +311,9 @@ func (c *Command) getCompletions(args []string) (*Command, []string, ShellCompDi
 			doCompleteFlags := func(flag *pflag.Flag) {
 				if !flag.Changed ||
 					strings.Contains(flag.Value.Type(), "Slice") ||
-					strings.Contains(flag.Value.Type(), "Array") {
-					// If the flag is not already present, or if it can be specified multiple times (Array or Slice)
+					strings.Contains(flag.Value.Type(), "Array") ||
+					flag.Value.Type() == "count" {
+					// If the flag is not already present, or if it can be specified multiple times (Array, Slice or count)
 					// we suggest it as a completion
 					completions = append(completions, getFlagNameCompletions(flag, toComplete)...)
 				}
@@ -307,6 +370,13 @@ func (c *Command) getCompletions(args []string) (*Command, []string, ShellCompDi
 				if subCmd.IsAvailableCommand() || subCmd == finalCmd.helpCommand {
 					if strings.HasPrefix(subCmd.Name(), toComplete) {
 						completions = append(completions, fmt.Sprintf("%s\t%s", subCmd.Name(), subCmd.Short))
+					} else {
+						// Offer the aliases only when the name itself does not match
+						for _, alias := range subCmd.Aliases {
+							if strings.HasPrefix(alias, toComplete) {
+								completions = append(completions, fmt.Sprintf("%s\t%s", alias, subCmd.Short))
+							}
+						}
 					}
 					directive = ShellCompDirectiveNoFileComp
 				}
@@ -352,21 +422,47 @@ func (c *Command) getCompletions(args []string) (*Command, []string, ShellCompDi
 	// Find the completion function for the flag or command
 	var completionFn func(cmd *Command, args []string, toComplete string) ([]string, ShellCompDirective)
 	if flag != nil {
-		completionFn = flagCompletionFunctions[flag]
+		completionFn = finalCmd.flagCompletionFunc(flag)
 	} else {
 		completionFn = finalCmd.ValidArgsFunction
 	}
+	if completionFn == nil && flag != nil && noFileCompFlagTypes[flag.Value.Type()] {
+		// The values of the flag are never files
+		directive = ShellCompDirectiveNoFileComp
+	}
 	if completionFn != nil {
 		// Go custom completion defined for this flag or command.
 		// Call the registered completion function to get the completions.
 		var comps []string
 		comps, directive = completionFn(finalCmd, finalArgs, toComplete)
+		if flag != nil {
+			comps = removeSliceFlagValues(flag, comps)
+		}
 		completions = append(completions, comps...)
 	}
 
 	return finalCmd, completions, directive, nil
 }
 
+// removeSliceFlagValues removes from completions the values already given
+// on the command-line to a flag that can be specified multiple times.
+func removeSliceFlagValues(flag *pflag.Flag, completions []string) []string {
+	sliceValue, ok := flag.Value.(pflag.SliceValue)
+	if !ok || !flag.Changed {
+		return completions
+	}
+	values := sliceValue.GetSlice()
+
+	var filtered []string
+	for _, comp := range completions {
+		// Ignore any description following a tab character.
+		if !stringInSlice(strings.Split(comp, "\t")[0], values) {
+			filtered = append(filtered, comp)
+		}
+	}
+	return filtered
+}
+
 func getFlagNameCompletions(flag *pflag.Flag, toComplete string) []string {
 	if nonCompletableFlag(flag) {
 		return []string{}
@@ -482,7 +578,7 @@ func checkIfFlagCompletion(finalCmd *Command, args []string, lastArg string) (*p
 	}
 
 	if !flagWithEqual {
-		if len(flag.NoOptDefVal) != 0 {
+		if takesArg, _ := flagspec.ValueSpec(flag); !takesArg {
 			// We had assumed dealing with a two-word flag but the flag is a boolean flag.
 			// In that case, there is no value following it, so we are not really doing flag completion.
 			// Reset everything to do noun completion.
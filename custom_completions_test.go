@@ -100,14 +100,16 @@ func TestCmdNameCompletionInGo(t *testing.T) {
 		t.Errorf("expected: %q, got: %q", expected, output)
 	}
 
-	// Test that even with no valid sub-command matches, hidden, deprecated and
-	// aliases are not completed
+	// Test that with no valid sub-command name matches, hidden and deprecated
+	// sub-commands are not completed, but the matching aliases are
 	output, err = executeCommand(rootCmd, ShellCompNoDescRequestCmd, "test")
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
 
 	expected = strings.Join([]string{
+		"testAlias",
+		"testSynonym",
 		":4",
 		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
 
@@ -956,6 +958,39 @@ func TestRequiredFlagNameCompletionInGo(t *testing.T) {
 	}
 }
 
+func TestFlagValueTypeCompletionInGo(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	rootCmd.Flags().Duration("timeout", 0, "timeout")
+	rootCmd.Flags().StringToString("labels", nil, "labels")
+	rootCmd.Flags().String("config", "", "config file")
+
+	tests := map[string]string{
+		"--timeout": "ShellCompDirectiveNoFileComp",
+		"--labels":  "ShellCompDirectiveNoFileComp",
+		"--config":  "ShellCompDirectiveDefault",
+	}
+	for flagName, directive := range tests {
+		output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, flagName, "")
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		checkStringContains(t, output, "Completion ended with directive: "+directive+"\n")
+		// No value, such as a key=value hint, is suggested
+		if !strings.HasPrefix(output, ":") {
+			t.Errorf("Expected no completion for %s, got %q", flagName, output)
+		}
+	}
+
+	// Both flags take a value in the bash completion script
+	buf := new(bytes.Buffer)
+	if err := rootCmd.GenBashCompletion(buf); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+	check(t, output, `two_word_flags+=("--timeout")`)
+	check(t, output, `two_word_flags+=("--labels")`)
+}
+
 func TestFlagFileExtFilterCompletionInGo(t *testing.T) {
 	rootCmd := &Command{
 		Use: "root",
@@ -1958,3 +1993,389 @@ func TestCompleteHelp(t *testing.T) {
 		t.Errorf("expected: %q, got: %q", expected, output)
 	}
 }
+
+func TestDefaultFlagCompletionInGo(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	child1Cmd := &Command{Use: "child1", Run: emptyRun}
+	child1Cmd.Flags().String("output", "", "output format")
+	child2Cmd := &Command{Use: "child2", Run: emptyRun}
+	child2Cmd.Flags().String("output", "", "output format")
+	child3Cmd := &Command{Use: "child3", Run: emptyRun}
+	child3Cmd.Flags().String("output", "", "output format")
+	child3Cmd.RegisterFlagCompletionFunc("output", func(cmd *Command, args []string, toComplete string) ([]string, ShellCompDirective) {
+		return []string{"custom"}, ShellCompDirectiveNoFileComp
+	})
+	rootCmd.AddCommand(child1Cmd, child2Cmd, child3Cmd)
+
+	err := rootCmd.RegisterDefaultFlagCompletionFunc("output", func(cmd *Command, args []string, toComplete string) ([]string, ShellCompDirective) {
+		return []string{"json", "yaml"}, ShellCompDirectiveNoFileComp
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := rootCmd.RegisterDefaultFlagCompletionFunc("output", nil); err == nil {
+		t.Error("Expected an error when registering the same flag name twice")
+	}
+
+	expected := strings.Join([]string{
+		"json",
+		"yaml",
+		":4",
+		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
+
+	for _, child := range []string{"child1", "child2"} {
+		output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, child, "--output", "")
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if output != expected {
+			t.Errorf("expected: %q, got: %q", expected, output)
+		}
+	}
+
+	// A function registered for the flag itself takes precedence
+	output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, "child3", "--output", "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	expected = strings.Join([]string{
+		"custom",
+		":4",
+		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+}
+
+func TestSliceFlagCompletionOmitsGivenValues(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	rootCmd.Flags().StringSlice("label", nil, "labels to apply")
+	rootCmd.RegisterFlagCompletionFunc("label", func(cmd *Command, args []string, toComplete string) ([]string, ShellCompDirective) {
+		return []string{"red\tThe red label", "green\tThe green label", "blue\tThe blue label"}, ShellCompDirectiveNoFileComp
+	})
+
+	output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, "--label", "red", "--label=blue", "--label", "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"green",
+		":4",
+		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
+
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+}
+
+func TestEnumFlagCompletion(t *testing.T) {
+	var format string
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	EnumVar(rootCmd.Flags(), &format, "format", []string{"json", "yaml", "table"}, "table", "output format")
+
+	output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, "--format", "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"json",
+		"yaml",
+		"table",
+		":4",
+		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
+
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+
+	output, err = executeCommand(rootCmd, ShellCompNoDescRequestCmd, "--format", "t")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected = strings.Join([]string{
+		"table",
+		":4",
+		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
+
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+}
+
+func TestFlagValidValuesAnnotation(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	rootCmd.Flags().String("format", "", "output format")
+	rootCmd.PersistentFlags().String("level", "", "log level")
+	if err := rootCmd.SetFlagAnnotation("format", BashCompValidValues, []string{"json", "yaml", "table"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := rootCmd.SetFlagAnnotation("level", BashCompValidValues, []string{"debug", "info"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := rootCmd.SetFlagAnnotation("unknown", BashCompValidValues, []string{"a"}); err == nil {
+		t.Error("Expected an error for an unknown flag")
+	}
+
+	output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, "--format", "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"json",
+		"yaml",
+		"table",
+		":4",
+		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
+
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+
+	output, err = executeCommand(rootCmd, ShellCompNoDescRequestCmd, "--level", "d")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected = strings.Join([]string{
+		"debug",
+		":4",
+		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
+
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+
+	buf := new(bytes.Buffer)
+	rootCmd.GenBashCompletion(buf)
+	check(t, buf.String(), `flags_with_completion+=("--format")`)
+	check(t, buf.String(), `flags_completion+=("__root_handle_go_custom_completion")`)
+}
+
+func TestCountFlagCompletion(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	rootCmd.Flags().CountP("verbose", "v", "increase verbosity")
+	rootCmd.Flags().BoolP("quiet", "q", false, "be quiet")
+
+	// A count flag is offered again after being given, unlike a bool flag
+	output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, "-v", "-q", "-")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"--verbose",
+		"-v",
+		":4",
+		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
+
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+
+	// A count flag takes no value
+	buf := new(bytes.Buffer)
+	rootCmd.GenBashCompletion(buf)
+	check(t, buf.String(), `flags+=("--verbose")`)
+	check(t, buf.String(), `flags+=("-v")`)
+	checkOmit(t, buf.String(), `two_word_flags+=("--verbose")`)
+	checkOmit(t, buf.String(), `two_word_flags+=("-v")`)
+}
+
+func TestPositionalArgumentCompletionReplacesZshMarks(t *testing.T) {
+	// MarkZshCompPositionalArgumentFile and MarkZshCompPositionalArgumentWords
+	// are deprecated and ignored; ValidArgsFunction completes per position.
+	rootCmd := &Command{
+		Use:  "root",
+		Args: ArbitraryArgs,
+		ValidArgsFunction: func(cmd *Command, args []string, toComplete string) ([]string, ShellCompDirective) {
+			switch len(args) {
+			case 0:
+				return []string{"create", "delete"}, ShellCompDirectiveNoFileComp
+			case 1:
+				return []string{"yaml", "json"}, ShellCompDirectiveFilterFileExt
+			}
+			return nil, ShellCompDirectiveNoFileComp
+		},
+		Run: emptyRun,
+	}
+	if err := rootCmd.MarkZshCompPositionalArgumentWords(1, "ignored"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if err := rootCmd.MarkZshCompPositionalArgumentFile(2, "*.ignored"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"create",
+		"delete",
+		":4",
+		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
+
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+
+	output, err = executeCommand(rootCmd, ShellCompNoDescRequestCmd, "create", "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected = strings.Join([]string{
+		"yaml",
+		"json",
+		":8",
+		"Completion ended with directive: ShellCompDirectiveFilterFileExt", ""}, "\n")
+
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+}
+
+func TestCompleteHelpSkipsHiddenCommandsAndFollowsAliases(t *testing.T) {
+	rootCmd := &Command{Use: "root", Args: NoArgs, Run: emptyRun}
+	childCmd := &Command{Use: "child", Aliases: []string{"kid"}, Run: emptyRun}
+	hiddenCmd := &Command{Use: "hidden", Hidden: true, Run: emptyRun}
+	rootCmd.AddCommand(childCmd, hiddenCmd)
+	grandchildCmd := &Command{Use: "grandchild", Run: emptyRun}
+	childCmd.AddCommand(grandchildCmd)
+
+	output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, "help", "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"child",
+		"help",
+		":4",
+		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
+
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+
+	output, err = executeCommand(rootCmd, ShellCompNoDescRequestCmd, "help", "kid", "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected = strings.Join([]string{
+		"grandchild",
+		":4",
+		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
+
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+
+	// The help command is completed by the Go code in bash too
+	buf := new(bytes.Buffer)
+	rootCmd.GenBashCompletion(buf)
+	start := strings.Index(buf.String(), "_root_help()")
+	if start < 0 {
+		t.Fatal("Expected a completion function for the help command")
+	}
+	check(t, buf.String()[start:], "has_completion_function=1")
+}
+
+func TestCompleteThroughCommandAlias(t *testing.T) {
+	// Aliases are offered when the name of the command does not match, and
+	// completion works for the commands and flags reached through them.
+	rootCmd := &Command{Use: "root", Args: NoArgs, Run: emptyRun}
+	removeCmd := &Command{Use: "remove", Aliases: []string{"rm", "delete"}, Short: "Remove things", Run: emptyRun}
+	removeCmd.Flags().Bool("force", false, "")
+	allCmd := &Command{Use: "all", Run: emptyRun}
+	removeCmd.AddCommand(allCmd)
+	rootCmd.AddCommand(removeCmd)
+
+	for toComplete, expectedCompletions := range map[string][]string{
+		"":   {"help\tHelp about any command", "remove\tRemove things"},
+		"r":  {"remove\tRemove things"},
+		"rm": {"rm\tRemove things"},
+		"d":  {"delete\tRemove things"},
+	} {
+		output, err := executeCommand(rootCmd, ShellCompRequestCmd, toComplete)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+
+		expected := strings.Join(append(expectedCompletions,
+			":4",
+			"Completion ended with directive: ShellCompDirectiveNoFileComp", ""), "\n")
+
+		if output != expected {
+			t.Errorf("%q: expected: %q, got: %q", toComplete, expected, output)
+		}
+	}
+
+	output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, "rm", "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"all",
+		":4",
+		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
+
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+
+	output, err = executeCommand(rootCmd, ShellCompNoDescRequestCmd, "rm", "--f")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected = strings.Join([]string{
+		"--force",
+		":4",
+		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
+
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+}
+
+func TestFlagValueCompletionAfterEqual(t *testing.T) {
+	var format string
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	EnumVar(rootCmd.Flags(), &format, "format", []string{"json", "yaml", "table"}, "table", "output format")
+	rootCmd.Flags().String("color", "", "color")
+	if err := rootCmd.RegisterFlagCompletionFunc("color", func(cmd *Command, args []string, toComplete string) ([]string, ShellCompDirective) {
+		return []string{"red", "green", "blue"}, ShellCompDirectiveNoFileComp
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		toComplete string
+		expected   []string
+	}{
+		{"--format=", []string{"json", "yaml", "table"}},
+		{"--format=y", []string{"yaml"}},
+		{"--color=", []string{"red", "green", "blue"}},
+	}
+	for _, tc := range tests {
+		output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, tc.toComplete)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+
+		expected := strings.Join(append(tc.expected,
+			":4",
+			"Completion ended with directive: ShellCompDirectiveNoFileComp", ""), "\n")
+		if output != expected {
+			t.Errorf("%s: expected: %q, got: %q", tc.toComplete, expected, output)
+		}
+	}
+}
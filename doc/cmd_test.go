@@ -1,6 +1,7 @@
 package doc
 
 import (
+	"bytes"
 	"strings"
 	"testing"
 
@@ -78,6 +79,103 @@ var dummyCmd = &cobra.Command{
 	Short: "Performs a dummy action",
 }
 
+func TestHiddenFlagsOmitted(t *testing.T) {
+	var secret string
+	rootCmd := &cobra.Command{Use: "root", Run: emptyRun}
+	childCmd := &cobra.Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().StringVar(&secret, "secret", "", "a hidden flag")
+	childCmd.Flags().String("visible", "", "a visible flag")
+	rootCmd.AddCommand(childCmd)
+	if err := childCmd.MarkFlagHidden("secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The hidden flag parses normally
+	buf := new(bytes.Buffer)
+	rootCmd.SetOut(buf)
+	rootCmd.SetErr(buf)
+	rootCmd.SetArgs([]string{"child", "--secret", "s3cr3t"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	if secret != "s3cr3t" {
+		t.Errorf("Expected the hidden flag to be set, got %q", secret)
+	}
+
+	outputs := map[string]func(*bytes.Buffer) error{
+		"help": func(buf *bytes.Buffer) error {
+			childCmd.SetOut(buf)
+			defer childCmd.SetOut(nil)
+			return childCmd.Help()
+		},
+		"man":  func(buf *bytes.Buffer) error { return GenMan(childCmd, &GenManHeader{}, buf) },
+		"md":   func(buf *bytes.Buffer) error { return GenMarkdown(childCmd, buf) },
+		"rest": func(buf *bytes.Buffer) error { return GenReST(childCmd, buf) },
+		"yaml": func(buf *bytes.Buffer) error { return GenYaml(childCmd, buf) },
+		"bash": func(buf *bytes.Buffer) error { return rootCmd.GenBashCompletion(buf) },
+		"debug": func(buf *bytes.Buffer) error {
+			childCmd.SetOut(buf)
+			defer childCmd.SetOut(nil)
+			childCmd.DebugFlags()
+			return nil
+		},
+		"zsh": func(buf *bytes.Buffer) error {
+			// Zsh completes flag names through the __complete command
+			rootCmd.SetOut(buf)
+			rootCmd.SetArgs([]string{cobra.ShellCompNoDescRequestCmd, "child", "--"})
+			return rootCmd.Execute()
+		},
+	}
+	for name, gen := range outputs {
+		buf := new(bytes.Buffer)
+		if err := gen(buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		output := buf.String()
+		if !strings.Contains(output, "visible") {
+			t.Errorf("%s: Expected the visible flag in %q", name, output)
+		}
+		if strings.Contains(output, "secret") {
+			t.Errorf("%s: Unexpected hidden flag in %q", name, output)
+		}
+	}
+}
+
+func TestGenDocsDoNotChangeFlags(t *testing.T) {
+	rootCmd := &cobra.Command{Use: "root", Run: emptyRun}
+	rootCmd.PersistentFlags().String("config", "", "config file")
+	childCmd := &cobra.Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().Bool("force", false, "force it")
+	rootCmd.AddCommand(childCmd)
+
+	outputs := map[string]func(*bytes.Buffer) error{
+		"man":        func(buf *bytes.Buffer) error { return GenMan(childCmd, &GenManHeader{}, buf) },
+		"man single": func(buf *bytes.Buffer) error { return GenManSingle(rootCmd, &GenManHeader{}, buf) },
+		"md":         func(buf *bytes.Buffer) error { return GenMarkdown(childCmd, buf) },
+		"rest":       func(buf *bytes.Buffer) error { return GenReST(childCmd, buf) },
+		"yaml":       func(buf *bytes.Buffer) error { return GenYaml(childCmd, buf) },
+	}
+	for name, gen := range outputs {
+		buf := new(bytes.Buffer)
+		if err := gen(buf); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		output := buf.String()
+		for _, flagName := range []string{"config", "force", "help"} {
+			if !strings.Contains(output, flagName) {
+				t.Errorf("%s: Expected the %q flag in %q", name, flagName, output)
+			}
+		}
+		for _, cmd := range []*cobra.Command{rootCmd, childCmd} {
+			for _, flagName := range []string{"config", "help"} {
+				if cmd.Flags().Lookup(flagName) != nil {
+					t.Errorf("%s: Expected the %q flag not to be added to the flags of %q", name, flagName, cmd.Name())
+				}
+			}
+		}
+	}
+}
+
 func checkStringContains(t *testing.T, got, expected string) {
 	if !strings.Contains(got, expected) {
 		t.Errorf("Expected to contain: \n %v\nGot:\n %v\n", expected, got)
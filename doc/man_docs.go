@@ -22,10 +22,13 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/cpuguy83/go-md2man/v2/md2man"
 	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/internal/flagspec"
 	"github.com/spf13/pflag"
 )
 
@@ -45,6 +48,59 @@ func GenManTree(cmd *cobra.Command, header *GenManHeader, dir string) error {
 // GenManTreeFromOpts generates a man page for the command and all descendants.
 // The pages are written to the opts.Path directory.
 func GenManTreeFromOpts(cmd *cobra.Command, opts GenManTreeOptions) error {
+	if opts.Workers <= 1 {
+		return genManTreePages(cmd, opts, writeManPage)
+	}
+
+	// Generating the markdown of a page touches the command tree, so it is
+	// done serially; the rendering and writing of the pages is not.
+	type manPage struct {
+		index    int
+		filename string
+		md       []byte
+	}
+	pages := make(chan manPage)
+	errs := map[int]error{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range pages {
+				if err := writeManPage(page.filename, page.md); err != nil {
+					mu.Lock()
+					errs[page.index] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	count := 0
+	err := genManTreePages(cmd, opts, func(filename string, md []byte) error {
+		pages <- manPage{count, filename, md}
+		count++
+		return nil
+	})
+	close(pages)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+
+	// Report the error of the first page in generation order.
+	for i := 0; i < count; i++ {
+		if err, ok := errs[i]; ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// genManTreePages generates the markdown of the man page of the command and
+// all descendants, passing each of them to fn along with its filename.
+func genManTreePages(cmd *cobra.Command, opts GenManTreeOptions, fn func(filename string, md []byte) error) error {
 	header := opts.Header
 	if header == nil {
 		header = &GenManHeader{}
@@ -53,7 +109,7 @@ func GenManTreeFromOpts(cmd *cobra.Command, opts GenManTreeOptions) error {
 		if !c.IsAvailableCommand() || c.IsAdditionalHelpTopicCommand() {
 			continue
 		}
-		if err := GenManTreeFromOpts(c, opts); err != nil {
+		if err := genManTreePages(c, opts, fn); err != nil {
 			return err
 		}
 	}
@@ -68,22 +124,45 @@ func GenManTreeFromOpts(cmd *cobra.Command, opts GenManTreeOptions) error {
 	}
 	basename := strings.Replace(cmd.CommandPath(), " ", separator, -1)
 	filename := filepath.Join(opts.Path, basename+"."+section)
+
+	headerCopy := *header
+	if err := fillHeader(&headerCopy, cmd.CommandPath(), cmd.DisableAutoGenTag); err != nil {
+		return err
+	}
+	md, err := genMan(cmd, &headerCopy)
+	if err != nil {
+		return err
+	}
+	return fn(filename, md)
+}
+
+// writeManPage renders the markdown of a man page to the given file.
+func writeManPage(filename string, md []byte) error {
 	f, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	headerCopy := *header
-	return GenMan(cmd, &headerCopy, f)
+	_, err = f.Write(md2man.Render(md))
+	return err
 }
 
+// ManTemplateAnnotation is the command annotation holding a template which
+// replaces the layout of the man page of the command. The template is executed
+// with the command as data and produces the markdown of the sections of the
+// page, which follow the title block made from the GenManHeader.
+const ManTemplateAnnotation = "cobra_annotation_man_template"
+
 // GenManTreeOptions is the options for generating the man pages.
 // Used only in GenManTreeFromOpts.
 type GenManTreeOptions struct {
 	Header           *GenManHeader
 	Path             string
 	CommandSeparator string
+	// Workers is the number of man pages rendered concurrently.
+	// Pages are rendered one after the other if it is lower than 2.
+	Workers int
 }
 
 // GenManHeader is a lot like the .TH header at the start of man pages. These
@@ -109,11 +188,72 @@ func GenMan(cmd *cobra.Command, header *GenManHeader, w io.Writer) error {
 		return err
 	}
 
-	b := genMan(cmd, header)
-	_, err := w.Write(md2man.Render(b))
+	b, err := genMan(cmd, header)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(md2man.Render(b))
+	return err
+}
+
+// GenManSingle will generate a single man page documenting the given command
+// and all its descendants, and write it to w. The subcommands are documented
+// in the COMMANDS section, each with its synopsis and options. The header
+// argument may be nil.
+func GenManSingle(cmd *cobra.Command, header *GenManHeader, w io.Writer) error {
+	if header == nil {
+		header = &GenManHeader{}
+	}
+	if err := fillHeader(header, cmd.CommandPath(), cmd.DisableAutoGenTag); err != nil {
+		return err
+	}
+
+	cmd.InitDefaultHelpCmd()
+
+	buf := new(bytes.Buffer)
+	manPreamble(buf, header, cmd, strings.Replace(cmd.CommandPath(), " ", "-", -1))
+	manPrintOptions(buf, cmd)
+	if len(cmd.Example) > 0 {
+		buf.WriteString("# EXAMPLE\n")
+		buf.WriteString(fmt.Sprintf("```\n%s\n```\n", cmd.RenderedExample()))
+	}
+	if cmd.HasAvailableSubCommands() {
+		buf.WriteString("# COMMANDS\n")
+		manPrintCommands(buf, cmd)
+	}
+	if !cmd.DisableAutoGenTag {
+		buf.WriteString(fmt.Sprintf("# HISTORY\n%s Auto generated by spf13/cobra\n", header.Date.Format("2-Jan-2006")))
+	}
+
+	_, err := w.Write(md2man.Render(buf.Bytes()))
 	return err
 }
 
+// manPrintCommands documents the available descendants of cmd, each under its
+// own heading.
+func manPrintCommands(buf *bytes.Buffer, cmd *cobra.Command) {
+	children := cmd.Commands()
+	sort.Sort(byName(children))
+	for _, c := range children {
+		if !c.IsAvailableCommand() || c.IsAdditionalHelpTopicCommand() {
+			continue
+		}
+
+		description := c.Long
+		if len(description) == 0 {
+			description = c.Short
+		}
+		buf.WriteString(fmt.Sprintf("### %s\n", c.CommandPath()))
+		buf.WriteString(fmt.Sprintf("**%s**\n\n", c.UseLine()))
+		buf.WriteString(description + "\n\n")
+		if flags := nonInheritedFlags(c); flags.HasAvailableFlags() {
+			manPrintFlags(buf, flags)
+			buf.WriteString("\n")
+		}
+		manPrintCommands(buf, c)
+	}
+}
+
 func fillHeader(header *GenManHeader, name string, disableAutoGen bool) error {
 	if header.Title == "" {
 		header.Title = strings.ToUpper(strings.Replace(name, " ", "\\-", -1))
@@ -139,17 +279,21 @@ func fillHeader(header *GenManHeader, name string, disableAutoGen bool) error {
 	return nil
 }
 
+func manTitleBlock(buf *bytes.Buffer, header *GenManHeader) {
+	buf.WriteString(fmt.Sprintf(`%% %s(%s)%s
+%% %s
+%% %s
+`, header.Title, header.Section, header.date, header.Source, header.Manual))
+}
+
 func manPreamble(buf *bytes.Buffer, header *GenManHeader, cmd *cobra.Command, dashedName string) {
 	description := cmd.Long
 	if len(description) == 0 {
 		description = cmd.Short
 	}
 
-	buf.WriteString(fmt.Sprintf(`%% %s(%s)%s
-%% %s
-%% %s
-# NAME
-`, header.Title, header.Section, header.date, header.Source, header.Manual))
+	manTitleBlock(buf, header)
+	buf.WriteString("# NAME\n")
 	buf.WriteString(fmt.Sprintf("%s \\- %s\n\n", dashedName, cmd.Short))
 	buf.WriteString("# SYNOPSIS\n")
 	buf.WriteString(fmt.Sprintf("**%s**\n\n", cmd.UseLine()))
@@ -157,6 +301,13 @@ func manPreamble(buf *bytes.Buffer, header *GenManHeader, cmd *cobra.Command, da
 	buf.WriteString(description + "\n\n")
 }
 
+// hasUsagePlaceholder reports whether usage contains a name for the value of
+// its flag between backticks.
+func hasUsagePlaceholder(usage string) bool {
+	start := strings.Index(usage, "`")
+	return start >= 0 && strings.Contains(usage[start+1:], "`")
+}
+
 func manPrintFlags(buf *bytes.Buffer, flags *pflag.FlagSet) {
 	flags.VisitAll(func(flag *pflag.Flag) {
 		if len(flag.Deprecated) > 0 || flag.Hidden {
@@ -168,25 +319,32 @@ func manPrintFlags(buf *bytes.Buffer, flags *pflag.FlagSet) {
 		} else {
 			format = fmt.Sprintf("**--%s**", flag.Name)
 		}
-		if len(flag.NoOptDefVal) > 0 {
-			format += "["
-		}
-		if flag.Value.Type() == "string" {
-			// put quotes on the value
-			format += "=%q"
-		} else {
-			format += "=%s"
+		takesArg, value := flagspec.ValueSpec(flag)
+		if takesArg {
+			// name the value by the name quoted in the usage, or by its type
+			format += "=" + value
+		} else if value != "" {
+			// show the default of the optional value; count flags take none
+			format += "[=" + value + "]"
 		}
-		if len(flag.NoOptDefVal) > 0 {
-			format += "]"
+		usage := flag.Usage
+		if hasUsagePlaceholder(flag.Usage) {
+			_, usage = pflag.UnquoteUsage(flag)
 		}
-		format += "\n\t%s\n\n"
-		buf.WriteString(fmt.Sprintf(format, flag.DefValue, flag.Usage))
+		buf.WriteString(format + "\n\t" + manFlagEnvVar(flag, usage) + "\n\n")
 	})
 }
 
+// manFlagEnvVar appends to usage the environment variables bound to flag.
+func manFlagEnvVar(flag *pflag.Flag, usage string) string {
+	if env := flag.Annotations[cobra.FlagEnvVarAnnotation]; len(env) > 0 {
+		return fmt.Sprintf("%s [env: %s]", usage, strings.Join(env, ", "))
+	}
+	return usage
+}
+
 func manPrintOptions(buf *bytes.Buffer, command *cobra.Command) {
-	flags := command.NonInheritedFlags()
+	flags := nonInheritedFlags(command)
 	if flags.HasAvailableFlags() {
 		buf.WriteString("# OPTIONS\n")
 		manPrintFlags(buf, flags)
@@ -200,9 +358,12 @@ func manPrintOptions(buf *bytes.Buffer, command *cobra.Command) {
 	}
 }
 
-func genMan(cmd *cobra.Command, header *GenManHeader) []byte {
+func genMan(cmd *cobra.Command, header *GenManHeader) ([]byte, error) {
 	cmd.InitDefaultHelpCmd()
-	cmd.InitDefaultHelpFlag()
+
+	if text, ok := cmd.Annotations[ManTemplateAnnotation]; ok {
+		return genManFromTemplate(cmd, header, text)
+	}
 
 	// something like `rootcmd-subcmd1-subcmd2`
 	dashCommandName := strings.Replace(cmd.CommandPath(), " ", "-", -1)
@@ -211,9 +372,20 @@ func genMan(cmd *cobra.Command, header *GenManHeader) []byte {
 
 	manPreamble(buf, header, cmd, dashCommandName)
 	manPrintOptions(buf, cmd)
+	if len(cmd.Aliases) > 0 {
+		buf.WriteString("# ALIASES\n")
+		invocations := make([]string, 0, len(cmd.Aliases))
+		for _, alias := range cmd.Aliases {
+			if cmd.HasParent() {
+				alias = cmd.Parent().CommandPath() + " " + alias
+			}
+			invocations = append(invocations, fmt.Sprintf("**%s**", alias))
+		}
+		buf.WriteString(strings.Join(invocations, ", ") + "\n\n")
+	}
 	if len(cmd.Example) > 0 {
 		buf.WriteString("# EXAMPLE\n")
-		buf.WriteString(fmt.Sprintf("```\n%s\n```\n", cmd.Example))
+		buf.WriteString(fmt.Sprintf("```\n%s\n```\n", cmd.RenderedExample()))
 	}
 	if hasSeeAlso(cmd) {
 		buf.WriteString("# SEE ALSO\n")
@@ -243,5 +415,20 @@ func genMan(cmd *cobra.Command, header *GenManHeader) []byte {
 	if !cmd.DisableAutoGenTag {
 		buf.WriteString(fmt.Sprintf("# HISTORY\n%s Auto generated by spf13/cobra\n", header.Date.Format("2-Jan-2006")))
 	}
-	return buf.Bytes()
+	return buf.Bytes(), nil
+}
+
+// genManFromTemplate generates the markdown of the man page of cmd with the
+// template text given by its ManTemplateAnnotation.
+func genManFromTemplate(cmd *cobra.Command, header *GenManHeader, text string) ([]byte, error) {
+	t, err := template.New("man").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid man template of %q: %v", cmd.CommandPath(), err)
+	}
+	buf := new(bytes.Buffer)
+	manTitleBlock(buf, header)
+	if err := t.Execute(buf, cmd); err != nil {
+		return nil, fmt.Errorf("cannot execute man template of %q: %v", cmd.CommandPath(), err)
+	}
+	return buf.Bytes(), nil
 }
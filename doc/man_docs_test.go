@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -130,6 +131,36 @@ func TestGenManSeeAlso(t *testing.T) {
 	}
 }
 
+func TestGenManSeeAlsoParentAndChildren(t *testing.T) {
+	rootCmd := &cobra.Command{Use: "root", Run: emptyRun}
+	subCmd := &cobra.Command{Use: "sub", Run: emptyRun}
+	subCmd.AddCommand(
+		&cobra.Command{Use: "zeta", Run: emptyRun},
+		&cobra.Command{Use: "alpha", Run: emptyRun},
+		&cobra.Command{Use: "mid", Run: emptyRun},
+	)
+	rootCmd.AddCommand(subCmd)
+
+	buf := new(bytes.Buffer)
+	header := &GenManHeader{}
+	if err := GenMan(subCmd, header, buf); err != nil {
+		t.Fatal(err)
+	}
+	scanner := bufio.NewScanner(buf)
+
+	if err := assertLineFound(scanner, ".SH SEE ALSO"); err != nil {
+		t.Fatalf("Couldn't find SEE ALSO section header: %v", err)
+	}
+	if err := assertNextLineEquals(scanner, ".PP"); err != nil {
+		t.Fatalf("First line after SEE ALSO wasn't break-indent: %v", err)
+	}
+	// The parent comes first, then the children in alphabetical order,
+	// without a trailing separator.
+	if err := assertNextLineEquals(scanner, `\fBroot(1)\fP, \fBroot\-sub\-alpha(1)\fP, \fBroot\-sub\-mid(1)\fP, \fBroot\-sub\-zeta(1)\fP`); err != nil {
+		t.Fatalf("Second line after SEE ALSO wasn't correct: %v", err)
+	}
+}
+
 func TestManPrintFlagsHidesShortDeperecated(t *testing.T) {
 	c := &cobra.Command{}
 	c.Flags().StringP("foo", "f", "default", "Foo flag")
@@ -139,7 +170,7 @@ func TestManPrintFlagsHidesShortDeperecated(t *testing.T) {
 	manPrintFlags(buf, c.Flags())
 
 	got := buf.String()
-	expected := "**--foo**=\"default\"\n\tFoo flag\n\n"
+	expected := "**--foo**=string\n\tFoo flag\n\n"
 	if got != expected {
 		t.Errorf("Expected %v, got %v", expected, got)
 	}
@@ -213,3 +244,333 @@ func BenchmarkGenManToFile(b *testing.B) {
 		}
 	}
 }
+
+func TestGenManUsagePlaceholder(t *testing.T) {
+	cmd := &cobra.Command{Use: "root", Run: emptyRun}
+	cmd.Flags().String("output", "out.txt", "write output to `FILE`")
+	cmd.Flags().Int("retries", 3, "number of retries")
+
+	buf := new(bytes.Buffer)
+	if err := GenMan(cmd, &GenManHeader{}, buf); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+
+	checkStringContains(t, output, translate("--output")+`\fP=FILE`)
+	checkStringContains(t, output, "write output to FILE")
+	checkStringOmits(t, output, "`")
+	checkStringOmits(t, output, "out.txt")
+	checkStringContains(t, output, translate("--retries")+`\fP=int`)
+}
+
+func TestGenManCountFlag(t *testing.T) {
+	cmd := &cobra.Command{Use: "root", Run: emptyRun}
+	cmd.Flags().CountP("verbose", "v", "increase verbosity")
+
+	buf := new(bytes.Buffer)
+	if err := GenMan(cmd, &GenManHeader{}, buf); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+
+	checkStringContains(t, output, `\fB\-v\fP, \fB\-\-verbose\fP
+	increase verbosity`)
+	checkStringOmits(t, output, translate("--verbose")+`\fP[`)
+	checkStringOmits(t, output, translate("--verbose")+`\fP=`)
+}
+
+func TestGenManSingle(t *testing.T) {
+	root := &cobra.Command{Use: "tool", Short: "A small tool", Long: "A small tool doing things", Run: emptyRun}
+	root.PersistentFlags().Bool("verbose", false, "verbose output")
+	get := &cobra.Command{Use: "get NAME", Short: "Get a thing", Run: emptyRun}
+	get.Flags().String("format", "", "output format")
+	set := &cobra.Command{Use: "set", Short: "Set things"}
+	setValue := &cobra.Command{Use: "value", Short: "Set a value", Run: emptyRun}
+	setValue.Flags().Int("count", 1, "number of values")
+	old := &cobra.Command{Use: "old", Short: "Old command", Deprecated: "use get", Run: emptyRun}
+	set.AddCommand(setValue)
+	root.AddCommand(get, set, old)
+
+	buf := new(bytes.Buffer)
+	if err := GenManSingle(root, &GenManHeader{Title: "TOOL", Section: "1"}, buf); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+
+	checkStringContains(t, output, "A small tool doing things")
+	checkStringContains(t, output, translate("--verbose"))
+	checkStringContains(t, output, ".SH COMMANDS")
+	for _, heading := range []string{"tool get", "tool set", "tool set value"} {
+		checkStringContains(t, output, ".SS "+heading+"\n")
+	}
+	getIndex := strings.Index(output, ".SS tool get\n")
+	setIndex := strings.Index(output, ".SS tool set\n")
+	valueIndex := strings.Index(output, ".SS tool set value\n")
+	if formatIndex := strings.Index(output, translate("--format")); formatIndex < getIndex || formatIndex > setIndex {
+		t.Errorf("Expected --format to be documented under tool get, got:\n%s", output)
+	}
+	if countIndex := strings.Index(output, translate("--count")); countIndex < valueIndex {
+		t.Errorf("Expected --count to be documented under tool set value, got:\n%s", output)
+	}
+	checkStringOmits(t, output, "tool old")
+	checkStringOmits(t, output, "tool help")
+}
+
+func TestGenManAliases(t *testing.T) {
+	rootCmd := &cobra.Command{Use: "root", Run: emptyRun}
+	childCmd := &cobra.Command{Use: "remove", Aliases: []string{"rm", "delete"}, Run: emptyRun}
+	rootCmd.AddCommand(childCmd)
+
+	buf := new(bytes.Buffer)
+	if err := GenMan(childCmd, &GenManHeader{}, buf); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+	checkStringContains(t, output, `.SH ALIASES
+.PP
+\fBroot rm\fP, \fBroot delete\fP`)
+
+	buf.Reset()
+	if err := GenMan(rootCmd, &GenManHeader{}, buf); err != nil {
+		t.Fatal(err)
+	}
+	checkStringOmits(t, buf.String(), "ALIASES")
+}
+
+func TestGenManTemplateAnnotation(t *testing.T) {
+	rootCmd := &cobra.Command{Use: "root", Short: "Root short", Run: emptyRun}
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve files",
+		Annotations: map[string]string{
+			ManTemplateAnnotation: "# NAME\n{{.Name}} \\- {{.Short}}\n\n# FILES\n/etc/root/serve.conf\n",
+		},
+		Run: emptyRun,
+	}
+	rootCmd.AddCommand(serveCmd)
+
+	buf := new(bytes.Buffer)
+	if err := GenMan(serveCmd, &GenManHeader{Title: "SERVE", Section: "5"}, buf); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+	checkStringContains(t, output, ".TH SERVE(5)")
+	checkStringContains(t, output, ".SH FILES\n.PP\n/etc/root/serve.conf")
+	checkStringOmits(t, output, "SYNOPSIS")
+
+	// Commands without a template keep the built-in layout
+	buf.Reset()
+	if err := GenMan(rootCmd, &GenManHeader{}, buf); err != nil {
+		t.Fatal(err)
+	}
+	checkStringContains(t, buf.String(), ".SH SYNOPSIS")
+	checkStringOmits(t, buf.String(), "FILES")
+
+	serveCmd.Annotations[ManTemplateAnnotation] = "{{.Oops"
+	if err := GenMan(serveCmd, &GenManHeader{}, buf); err == nil {
+		t.Error("Expected an error for an invalid man template")
+	}
+}
+
+func TestGenManHiddenFlags(t *testing.T) {
+	rootCmd := &cobra.Command{Use: "root", Run: emptyRun}
+	rootCmd.PersistentFlags().String("secret-global", "", "")
+	childCmd := &cobra.Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().String("secret", "", "")
+	childCmd.Flags().String("visible", "", "")
+	rootCmd.AddCommand(childCmd)
+	if err := childCmd.MarkFlagHidden("secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rootCmd.MarkPersistentFlagHidden("secret-global"); err != nil {
+		t.Fatal(err)
+	}
+	if err := childCmd.MarkFlagHidden("unknown"); err == nil {
+		t.Error("Expected an error for an unknown flag")
+	}
+
+	buf := new(bytes.Buffer)
+	if err := GenMan(childCmd, &GenManHeader{}, buf); err != nil {
+		t.Fatal(err)
+	}
+	checkStringContains(t, buf.String(), translate("--visible"))
+	checkStringOmits(t, buf.String(), "secret")
+
+	buf.Reset()
+	childCmd.SetOut(buf)
+	if err := childCmd.Help(); err != nil {
+		t.Fatal(err)
+	}
+	checkStringContains(t, buf.String(), "--visible")
+	checkStringOmits(t, buf.String(), "secret")
+}
+
+func TestGenManFlagEnvVar(t *testing.T) {
+	cmd := &cobra.Command{Use: "serve", Run: emptyRun}
+	cmd.Flags().Int("port", 8080, "port to listen on")
+	cmd.Flags().String("host", "", "host to listen on")
+	if err := cmd.SetFlagAnnotation("port", cobra.FlagEnvVarAnnotation, []string{"MYAPP_PORT"}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := GenMan(cmd, &GenManHeader{}, buf); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+	checkStringContains(t, output, `port to listen on [env: MYAPP\_PORT]`)
+	checkStringOmits(t, output, "host to listen on [env:")
+}
+
+func TestGenManFlagOrder(t *testing.T) {
+	rootCmd := &cobra.Command{Use: "root", Run: emptyRun}
+	rootCmd.PersistentFlags().String("zeta", "", "")
+	rootCmd.PersistentFlags().String("alpha", "", "")
+	childCmd := &cobra.Command{Use: "child", Run: emptyRun}
+	childCmd.Flags().String("yankee", "", "")
+	childCmd.PersistentFlags().String("bravo", "", "")
+	rootCmd.AddCommand(childCmd)
+
+	buf := new(bytes.Buffer)
+	if err := GenMan(childCmd, &GenManHeader{}, buf); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+
+	prev := -1
+	for _, name := range []string{"bravo", "yankee", "alpha", "zeta"} {
+		index := strings.Index(output, translate("--"+name))
+		if index < 0 || index < prev {
+			t.Errorf("Expected %q to be listed in order, got:\n%s", name, output)
+		}
+		prev = index
+	}
+}
+
+func TestGenManInheritedOptions(t *testing.T) {
+	rootCmd := &cobra.Command{Use: "root", Run: emptyRun}
+	rootCmd.PersistentFlags().String("rootflag", "", "root persistent flag")
+	rootCmd.PersistentFlags().String("shared", "", "shared flag from root")
+	midCmd := &cobra.Command{Use: "mid", Run: emptyRun}
+	midCmd.PersistentFlags().String("midflag", "", "mid persistent flag")
+	midCmd.PersistentFlags().String("shared", "", "shared flag from mid")
+	leafCmd := &cobra.Command{Use: "leaf", Run: emptyRun}
+	leafCmd.Flags().String("leafflag", "", "leaf local flag")
+	midCmd.AddCommand(leafCmd)
+	rootCmd.AddCommand(midCmd)
+
+	buf := new(bytes.Buffer)
+	if err := GenMan(leafCmd, &GenManHeader{}, buf); err != nil {
+		t.Fatal(err)
+	}
+	output := buf.String()
+
+	index := strings.Index(output, "OPTIONS INHERITED FROM PARENT COMMANDS")
+	if index < 0 {
+		t.Fatalf("Expected an inherited options section, got:\n%s", output)
+	}
+	local, inherited := output[:index], output[index:]
+
+	checkStringContains(t, local, translate("leafflag"))
+	for _, name := range []string{"rootflag", "midflag", "shared"} {
+		checkStringOmits(t, local, translate("--"+name))
+		if n := strings.Count(inherited, translate("--"+name)); n != 1 {
+			t.Errorf("Expected %q to be listed once as inherited, found %d times", name, n)
+		}
+	}
+	checkStringContains(t, inherited, "shared flag from mid")
+	checkStringOmits(t, inherited, "shared flag from root")
+}
+
+// largeCommandTree returns a root command with width subcommands,
+// each having width subcommands of their own.
+func largeCommandTree(width int) *cobra.Command {
+	root := &cobra.Command{Use: "mycmd", Short: "Root command", Run: emptyRun}
+	root.PersistentFlags().String("config", "", "config file")
+	for i := 0; i < width; i++ {
+		sub := &cobra.Command{Use: fmt.Sprintf("sub%d", i), Short: "Subcommand", Run: emptyRun}
+		sub.Flags().Int("count", 0, "number of items")
+		for j := 0; j < width; j++ {
+			subsub := &cobra.Command{Use: fmt.Sprintf("sub%dsub%d", i, j), Short: "Nested subcommand", Run: emptyRun}
+			subsub.Flags().Bool("force", false, "force the operation")
+			sub.AddCommand(subsub)
+		}
+		root.AddCommand(sub)
+	}
+	return root
+}
+
+func TestGenManTreeWorkers(t *testing.T) {
+	date := time.Date(2020, 10, 14, 0, 0, 0, 0, time.UTC)
+	genTree := func(workers int) string {
+		tmpdir, err := ioutil.TempDir("", "test-gen-man-tree-workers")
+		if err != nil {
+			t.Fatalf("Failed to create tmpdir: %s", err.Error())
+		}
+		err = GenManTreeFromOpts(largeCommandTree(5), GenManTreeOptions{
+			Header:  &GenManHeader{Date: &date},
+			Path:    tmpdir,
+			Workers: workers,
+		})
+		if err != nil {
+			t.Fatalf("GenManTreeFromOpts failed: %s", err.Error())
+		}
+		return tmpdir
+	}
+
+	serialDir := genTree(1)
+	defer os.RemoveAll(serialDir)
+	parallelDir := genTree(4)
+	defer os.RemoveAll(parallelDir)
+
+	files, err := ioutil.ReadDir(serialDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 31 {
+		t.Fatalf("Expected 31 man pages, got %d", len(files))
+	}
+	for _, file := range files {
+		serial, err := ioutil.ReadFile(filepath.Join(serialDir, file.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parallel, err := ioutil.ReadFile(filepath.Join(parallelDir, file.Name()))
+		if err != nil {
+			t.Fatalf("Expected file %q to be generated concurrently: %v", file.Name(), err)
+		}
+		if !bytes.Equal(serial, parallel) {
+			t.Errorf("Expected %q to be identical when generated concurrently", file.Name())
+		}
+	}
+}
+
+func TestGenManTreeWorkersError(t *testing.T) {
+	err := GenManTreeFromOpts(largeCommandTree(2), GenManTreeOptions{
+		Path:    filepath.Join(os.TempDir(), "does-not-exist", "test-gen-man-tree"),
+		Workers: 4,
+	})
+	if err == nil {
+		t.Fatal("Expected an error writing to a missing directory")
+	}
+	checkStringContains(t, err.Error(), "mycmd_sub0_sub0sub0.1")
+}
+
+func benchmarkGenManTree(b *testing.B, workers int) {
+	tmpdir, err := ioutil.TempDir("", "bench-gen-man-tree")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	root := largeCommandTree(15)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := GenManTreeFromOpts(root, GenManTreeOptions{Path: tmpdir, Workers: workers}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenManTreeSerial(b *testing.B)   { benchmarkGenManTree(b, 1) }
+func BenchmarkGenManTreeParallel(b *testing.B) { benchmarkGenManTree(b, 8) }
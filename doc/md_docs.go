@@ -27,7 +27,7 @@ import (
 )
 
 func printOptions(buf *bytes.Buffer, cmd *cobra.Command, name string) error {
-	flags := cmd.NonInheritedFlags()
+	flags := nonInheritedFlags(cmd)
 	flags.SetOutput(buf)
 	if flags.HasAvailableFlags() {
 		buf.WriteString("### Options\n\n```\n")
@@ -53,7 +53,6 @@ func GenMarkdown(cmd *cobra.Command, w io.Writer) error {
 // GenMarkdownCustom creates custom markdown output.
 func GenMarkdownCustom(cmd *cobra.Command, w io.Writer, linkHandler func(string) string) error {
 	cmd.InitDefaultHelpCmd()
-	cmd.InitDefaultHelpFlag()
 
 	buf := new(bytes.Buffer)
 	name := cmd.CommandPath()
@@ -71,7 +70,7 @@ func GenMarkdownCustom(cmd *cobra.Command, w io.Writer, linkHandler func(string)
 
 	if len(cmd.Example) > 0 {
 		buf.WriteString("### Examples\n\n")
-		buf.WriteString(fmt.Sprintf("```\n%s\n```\n\n", cmd.Example))
+		buf.WriteString(fmt.Sprintf("```\n%s\n```\n\n", cmd.RenderedExample()))
 	}
 
 	if err := printOptions(buf, cmd, name); err != nil {
@@ -42,6 +42,17 @@ func TestGenMdDocWithNoLongOrSynopsis(t *testing.T) {
 	checkStringOmits(t, output, "### Synopsis")
 }
 
+func TestGenMdDocWithUseLine(t *testing.T) {
+	cmd := &cobra.Command{Use: "tool", Short: "Run the tool", Run: emptyRun}
+	cmd.SetUseLine("tool run [options] FILE")
+
+	buf := new(bytes.Buffer)
+	if err := GenMarkdown(cmd, buf); err != nil {
+		t.Fatal(err)
+	}
+	checkStringContains(t, buf.String(), "```\ntool run [options] FILE\n```")
+}
+
 func TestGenMdNoHiddenParents(t *testing.T) {
 	// We generate on subcommand so we have both subcommands and parents.
 	for _, name := range []string{"rootflag", "strtwo"} {
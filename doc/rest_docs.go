@@ -27,7 +27,7 @@ import (
 )
 
 func printOptionsReST(buf *bytes.Buffer, cmd *cobra.Command, name string) error {
-	flags := cmd.NonInheritedFlags()
+	flags := nonInheritedFlags(cmd)
 	flags.SetOutput(buf)
 	if flags.HasAvailableFlags() {
 		buf.WriteString("Options\n")
@@ -60,7 +60,6 @@ func GenReST(cmd *cobra.Command, w io.Writer) error {
 // GenReSTCustom creates custom reStructured Text output.
 func GenReSTCustom(cmd *cobra.Command, w io.Writer, linkHandler func(string, string) string) error {
 	cmd.InitDefaultHelpCmd()
-	cmd.InitDefaultHelpFlag()
 
 	buf := new(bytes.Buffer)
 	name := cmd.CommandPath()
@@ -87,7 +86,7 @@ func GenReSTCustom(cmd *cobra.Command, w io.Writer, linkHandler func(string, str
 	if len(cmd.Example) > 0 {
 		buf.WriteString("Examples\n")
 		buf.WriteString("~~~~~~~~\n\n")
-		buf.WriteString(fmt.Sprintf("::\n\n%s\n\n", indentString(cmd.Example, "  ")))
+		buf.WriteString(fmt.Sprintf("::\n\n%s\n\n", indentString(cmd.RenderedExample(), "  ")))
 	}
 
 	if err := printOptionsReST(buf, cmd, name); err != nil {
@@ -17,8 +17,25 @@ import (
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
+// nonInheritedFlags returns the flags of cmd which are not inherited, with
+// the help flag added to cmd when it is executed, without adding it to cmd or
+// merging the inherited flags into its flags.
+func nonInheritedFlags(cmd *cobra.Command) *pflag.FlagSet {
+	flags := cmd.NonInheritedFlags()
+	help := cmd.DefaultHelpFlag()
+	if help == nil {
+		return flags
+	}
+	withHelp := pflag.NewFlagSet(cmd.Name(), pflag.ContinueOnError)
+	withHelp.SortFlags = flags.SortFlags
+	withHelp.AddFlagSet(flags)
+	withHelp.AddFlag(help)
+	return withHelp
+}
+
 // Test to see if we have a reason to print See Also information in docs
 // Basically this is a test for a parent command or a subcommand which is
 // both not deprecated and not the autogenerated help command.
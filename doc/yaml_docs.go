@@ -35,13 +35,14 @@ type cmdOption struct {
 
 type cmdDoc struct {
 	Name             string
-	Synopsis         string      `yaml:",omitempty"`
-	Description      string      `yaml:",omitempty"`
-	Usage            string      `yaml:",omitempty"`
-	Options          []cmdOption `yaml:",omitempty"`
-	InheritedOptions []cmdOption `yaml:"inherited_options,omitempty"`
-	Example          string      `yaml:",omitempty"`
-	SeeAlso          []string    `yaml:"see_also,omitempty"`
+	Synopsis         string            `yaml:",omitempty"`
+	Description      string            `yaml:",omitempty"`
+	Usage            string            `yaml:",omitempty"`
+	Options          []cmdOption       `yaml:",omitempty"`
+	InheritedOptions []cmdOption       `yaml:"inherited_options,omitempty"`
+	Example          string            `yaml:",omitempty"`
+	SeeAlso          []string          `yaml:"see_also,omitempty"`
+	Annotations      map[string]string `yaml:",omitempty"`
 }
 
 // GenYamlTree creates yaml structured ref files for this command and all descendants
@@ -91,7 +92,6 @@ func GenYaml(cmd *cobra.Command, w io.Writer) error {
 // GenYamlCustom creates custom yaml output.
 func GenYamlCustom(cmd *cobra.Command, w io.Writer, linkHandler func(string) string) error {
 	cmd.InitDefaultHelpCmd()
-	cmd.InitDefaultHelpFlag()
 
 	yamlDoc := cmdDoc{}
 	yamlDoc.Name = cmd.CommandPath()
@@ -104,10 +104,21 @@ func GenYamlCustom(cmd *cobra.Command, w io.Writer, linkHandler func(string) str
 	}
 
 	if len(cmd.Example) > 0 {
-		yamlDoc.Example = cmd.Example
+		yamlDoc.Example = cmd.RenderedExample()
 	}
 
-	flags := cmd.NonInheritedFlags()
+	for key, value := range cmd.Annotations {
+		// leave out the annotations cobra uses itself, such as the man template
+		if strings.HasPrefix(key, "cobra_annotation_") {
+			continue
+		}
+		if yamlDoc.Annotations == nil {
+			yamlDoc.Annotations = make(map[string]string)
+		}
+		yamlDoc.Annotations[key] = value
+	}
+
+	flags := nonInheritedFlags(cmd)
 	if flags.HasFlags() {
 		yamlDoc.Options = genFlagResult(flags)
 	}
@@ -149,6 +160,9 @@ func genFlagResult(flags *pflag.FlagSet) []cmdOption {
 	var result []cmdOption
 
 	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Hidden {
+			return
+		}
 		// Todo, when we mark a shorthand is deprecated, but specify an empty message.
 		// The flag.ShorthandDeprecated is empty as the shorthand is deprecated.
 		// Using len(flag.ShorthandDeprecated) > 0 can't handle this, others are ok.
@@ -83,3 +83,29 @@ func BenchmarkGenYamlToFile(b *testing.B) {
 		}
 	}
 }
+
+func TestGenYamlAnnotations(t *testing.T) {
+	c := &cobra.Command{Use: "do", Run: emptyRun}
+	c.SetAnnotation("category", "telemetry")
+
+	buf := new(bytes.Buffer)
+	if err := GenYaml(c, buf); err != nil {
+		t.Fatal(err)
+	}
+	checkStringContains(t, buf.String(), "annotations:\n  category: telemetry\n")
+
+	c.SetAnnotation(ManTemplateAnnotation, "# NAME\n{{.Name}}\n")
+	buf.Reset()
+	if err := GenYaml(c, buf); err != nil {
+		t.Fatal(err)
+	}
+	checkStringContains(t, buf.String(), "annotations:\n  category: telemetry\n")
+	checkStringOmits(t, buf.String(), ManTemplateAnnotation)
+
+	c.Annotations = map[string]string{ManTemplateAnnotation: "# NAME\n"}
+	buf.Reset()
+	if err := GenYaml(c, buf); err != nil {
+		t.Fatal(err)
+	}
+	checkStringOmits(t, buf.String(), "annotations:")
+}
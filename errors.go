@@ -0,0 +1,110 @@
+package cobra
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrUnknownCommand is matched by errors.Is for the errors reporting that
+	// an argument is not a known sub command.
+	ErrUnknownCommand = errors.New("unknown command")
+
+	// ErrUnknownFlag is matched by errors.Is for the errors reporting that a
+	// flag is not defined.
+	ErrUnknownFlag = errors.New("unknown flag")
+
+	// ErrSubCommandRequired is returned by Execute when the root command is not
+	// runnable but has sub commands and is called without one. The help of the
+	// command is shown instead of the error. Other commands which are not
+	// runnable only show their help.
+	ErrSubCommandRequired = errors.New("subcommand is required")
+)
+
+// unknownCommandError is an error reporting an unknown command, matching
+// ErrUnknownCommand.
+type unknownCommandError struct {
+	msg string
+}
+
+func (e *unknownCommandError) Error() string {
+	return e.msg
+}
+
+func (e *unknownCommandError) Is(target error) bool {
+	return target == ErrUnknownCommand
+}
+
+// UnknownFlagError wraps the error returned by pflag when parsing an
+// undefined flag. It matches ErrUnknownFlag.
+type UnknownFlagError struct {
+	Err error
+}
+
+func (e *UnknownFlagError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UnknownFlagError) Unwrap() error {
+	return e.Err
+}
+
+func (e *UnknownFlagError) Is(target error) bool {
+	return target == ErrUnknownFlag
+}
+
+// commandPathError prefixes an error with the path of the command which
+// reported it.
+type commandPathError struct {
+	path string
+	err  error
+}
+
+func (e *commandPathError) Error() string {
+	return e.path + ": " + e.err.Error()
+}
+
+func (e *commandPathError) Unwrap() error {
+	return e.err
+}
+
+// validationErrors are the errors found when validating a command in
+// AllErrors validation mode. errors.Is and errors.As match each of them.
+type validationErrors []error
+
+func (e validationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e validationErrors) Unwrap() []error {
+	return e
+}
+
+// joinValidationErrors returns nil if there are no errors, the only error if
+// there is one, and all of them as a validationErrors otherwise.
+func joinValidationErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return validationErrors(errs)
+}
+
+// wrapFlagError returns err wrapped in an UnknownFlagError if it reports an
+// undefined flag, and err otherwise.
+func wrapFlagError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if strings.HasPrefix(msg, "unknown flag: ") || strings.HasPrefix(msg, "unknown shorthand flag: ") {
+		return &UnknownFlagError{Err: err}
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+package cobra
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestUnknownCommandError(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	childCmd := &Command{Use: "child", Args: NoArgs, Run: emptyRun}
+	root.AddCommand(childCmd)
+
+	for _, args := range [][]string{{"unknown"}, {"child", "unknown"}} {
+		_, err := executeCommand(root, args...)
+		if !errors.Is(err, ErrUnknownCommand) {
+			t.Errorf("Expected %v to match ErrUnknownCommand", err)
+		}
+		if errors.Is(err, ErrUnknownFlag) {
+			t.Errorf("Expected %v not to match ErrUnknownFlag", err)
+		}
+	}
+
+	_, err := executeCommand(root, "unknown")
+	expected := `unknown command "unknown" for "root"`
+	if err.Error() != expected {
+		t.Errorf("Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestUnknownFlagError(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.Flags().BoolP("verbose", "v", false, "")
+
+	for _, args := range [][]string{{"--unknown"}, {"-vx"}} {
+		_, err := executeCommand(root, args...)
+		if !errors.Is(err, ErrUnknownFlag) {
+			t.Errorf("Expected %v to match ErrUnknownFlag", err)
+		}
+		if errors.Is(err, ErrUnknownCommand) {
+			t.Errorf("Expected %v not to match ErrUnknownCommand", err)
+		}
+		var flagErr *UnknownFlagError
+		if !errors.As(err, &flagErr) {
+			t.Errorf("Expected %v to be an UnknownFlagError", err)
+		}
+	}
+
+	_, err := executeCommand(root, "--unknown")
+	expected := "unknown flag: --unknown"
+	if err.Error() != expected {
+		t.Errorf("Expected error %q, got %q", expected, err.Error())
+	}
+
+	// Other flag errors are returned as is.
+	_, err = executeCommand(root, "--verbose=maybe")
+	if err == nil || errors.Is(err, ErrUnknownFlag) {
+		t.Errorf("Expected an invalid value error, got %v", err)
+	}
+}
+
+func TestSubCommandRequiredError(t *testing.T) {
+	root := &Command{Use: "root"}
+	childCmd := &Command{Use: "child", Short: "the child", Run: emptyRun}
+	root.AddCommand(childCmd)
+
+	output, err := executeCommand(root)
+	if !errors.Is(err, ErrSubCommandRequired) {
+		t.Errorf("Expected ErrSubCommandRequired, got %v", err)
+	}
+	if errors.Is(err, ErrUnknownCommand) {
+		t.Errorf("Expected %v not to match ErrUnknownCommand", err)
+	}
+	checkStringContains(t, output, "Available Commands:")
+	checkStringContains(t, output, "child       the child")
+	checkStringOmits(t, output, "Error:")
+
+	// A non runnable command without sub commands only shows its help
+	leaf := &Command{Use: "leaf"}
+	if _, err := executeCommand(leaf); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// So does a non runnable sub command grouping others
+	groupCmd := &Command{Use: "group"}
+	groupCmd.AddCommand(&Command{Use: "member", Short: "a member", Run: emptyRun})
+	root.AddCommand(groupCmd)
+	output, err = executeCommand(root, "group")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "member      a member")
+}
+
+func TestErrorPathPrefix(t *testing.T) {
+	root := &Command{Use: "myapp", Run: emptyRun}
+	sub := &Command{Use: "sub", Run: emptyRun}
+	leaf := &Command{Use: "leaf", Args: ExactArgs(1), Run: emptyRun}
+	leaf.Flags().Int("count", 0, "")
+	sub.AddCommand(leaf)
+	root.AddCommand(sub)
+	root.SetErrorPathPrefix(true)
+
+	_, err := executeCommand(root, "sub", "leaf", "--unknown")
+	if err == nil || !strings.HasPrefix(err.Error(), "myapp sub leaf: unknown flag: --unknown") {
+		t.Errorf("Expected the flag error to be prefixed with the command path, got %v", err)
+	}
+	if !errors.Is(err, ErrUnknownFlag) {
+		t.Errorf("Expected %v to match ErrUnknownFlag", err)
+	}
+
+	_, err = executeCommand(root, "sub", "leaf", "--count", "x", "arg")
+	if err == nil || !strings.HasPrefix(err.Error(), "myapp sub leaf: invalid argument") {
+		t.Errorf("Expected the flag error to be prefixed with the command path, got %v", err)
+	}
+
+	_, err = executeCommand(root, "sub", "leaf")
+	expected := "myapp sub leaf: accepts 1 arg(s), received 0"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+
+	root.SetErrorPathPrefix(false)
+	_, err = executeCommand(root, "sub", "leaf")
+	expected = "accepts 1 arg(s), received 0"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
@@ -0,0 +1,164 @@
+package cobra
+
+import (
+	"fmt"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// Kinds of flag constraints.
+const (
+	requiredAsGroup   = "cobra_annotation_required_if_others_set"
+	mutuallyExclusive = "cobra_annotation_mutually_exclusive"
+	requiredIfChanged = "cobra_annotation_required_if_changed"
+)
+
+// MarkFlagsRequiredTogether marks the given flags as a group which must be set
+// together: if any of them is set on the command-line, all of them must be.
+// The flags may be local to the command or inherited from a parent.
+func (c *Command) MarkFlagsRequiredTogether(flagNames ...string) error {
+	return c.markFlagGroup(requiredAsGroup, flagNames)
+}
+
+// MarkFlagsMutuallyExclusive marks the given flags as a group of which at most
+// one can be set on the command-line.
+// The flags may be local to the command or inherited from a parent.
+func (c *Command) MarkFlagsMutuallyExclusive(flagNames ...string) error {
+	return c.markFlagGroup(mutuallyExclusive, flagNames)
+}
+
+// MarkFlagRequiredIfChanged marks the flag flagName as required when the flag
+// otherFlagName is set on the command-line. It can be called several times for
+// the same flag, which is then required when any of the other flags is set.
+// The flags may be local to the command or inherited from a parent.
+func (c *Command) MarkFlagRequiredIfChanged(flagName, otherFlagName string) error {
+	c.mergePersistentFlags()
+	for _, name := range []string{otherFlagName, flagName} {
+		if c.Flags().Lookup(name) == nil {
+			return fmt.Errorf("no such flag -%v", name)
+		}
+	}
+	c.flagConstraints = append(c.flagConstraints, flagConstraint{kind: requiredIfChanged, flagNames: []string{flagName, otherFlagName}})
+	return nil
+}
+
+// flagConstraint is a group of flags of a given kind, marked on a command. A
+// requiredIfChanged constraint holds the required flag, then the other flag.
+// It is kept by the command rather than as an annotation of the flags, which
+// the command may share with its parent and siblings.
+type flagConstraint struct {
+	kind      string
+	flagNames []string
+}
+
+func (c *Command) markFlagGroup(kind string, flagNames []string) error {
+	c.mergePersistentFlags()
+	for _, name := range flagNames {
+		if c.Flags().Lookup(name) == nil {
+			return fmt.Errorf("no such flag -%v", name)
+		}
+	}
+	c.flagConstraints = append(c.flagConstraints, flagConstraint{kind: kind, flagNames: copyStrings(flagNames)})
+	return nil
+}
+
+// withFlagGroupUsages returns flags, or a copy of it in which the usage of the
+// flags belonging to mutually exclusive or required together groups of c
+// notes the other flags of their groups.
+func (c *Command) withFlagGroupUsages(flags *flag.FlagSet) *flag.FlagSet {
+	grouped := false
+	for _, group := range c.flagConstraints {
+		grouped = grouped || group.kind == mutuallyExclusive || group.kind == requiredAsGroup
+	}
+	if !grouped {
+		return flags
+	}
+
+	withUsages := flag.NewFlagSet("", flag.ContinueOnError)
+	withUsages.SortFlags = flags.SortFlags
+	flags.VisitAll(func(f *flag.Flag) {
+		fc := *f
+		if others := c.otherFlagsInGroups(f, mutuallyExclusive); others != "" {
+			fc.Usage += " (mutually exclusive with " + others + ")"
+		}
+		if others := c.otherFlagsInGroups(f, requiredAsGroup); others != "" {
+			fc.Usage += " (required together with " + others + ")"
+		}
+		withUsages.AddFlag(&fc)
+	})
+	return withUsages
+}
+
+// otherFlagsInGroups lists the flags, other than f, of the groups of the given
+// kind of c which f belongs to.
+func (c *Command) otherFlagsInGroups(f *flag.Flag, kind string) string {
+	var others []string
+	for _, group := range c.flagConstraints {
+		if group.kind != kind || !stringInSlice(f.Name, group.flagNames) {
+			continue
+		}
+		for _, name := range group.flagNames {
+			if name != f.Name && !stringInSlice("--"+name, others) {
+				others = append(others, "--"+name)
+			}
+		}
+	}
+	return strings.Join(others, ", ")
+}
+
+// validateFlagGroups checks that the flag groups and conditional requirements
+// of c are respected by the flags set on the command-line.
+func (c *Command) validateFlagGroups() error {
+	if c.DisableFlagParsing {
+		return nil
+	}
+
+	// In AllErrors validation mode, every violated constraint is reported
+	var errs []error
+	report := func(err error) bool {
+		errs = append(errs, err)
+		return c.ValidationMode() != AllErrors
+	}
+
+	flags := c.Flags()
+	for _, constraint := range c.flagConstraints {
+		if constraint.kind != requiredIfChanged {
+			continue
+		}
+		name, other := constraint.flagNames[0], constraint.flagNames[1]
+		if !flags.Changed(name) && flags.Changed(other) {
+			if report(fmt.Errorf("flag %q is required when %q is set", name, other)) {
+				return errs[0]
+			}
+		}
+	}
+
+	for _, kind := range []string{requiredAsGroup, mutuallyExclusive} {
+		for _, group := range c.flagConstraints {
+			if group.kind != kind {
+				continue
+			}
+			var set, missing []string
+			for _, name := range group.flagNames {
+				if flags.Changed(name) {
+					set = append(set, name)
+				} else {
+					missing = append(missing, name)
+				}
+			}
+			names := strings.Join(group.flagNames, " ")
+			if kind == requiredAsGroup && len(set) > 0 && len(missing) > 0 {
+				if report(fmt.Errorf("if any flags in the group [%v] are set they must all be set; missing %v", names, missing)) {
+					return errs[0]
+				}
+			}
+			if kind == mutuallyExclusive && len(set) > 1 {
+				if report(fmt.Errorf("if any flags in the group [%v] are set none of the others can be; %v were all set", names, set)) {
+					return errs[0]
+				}
+			}
+		}
+	}
+	return joinValidationErrors(errs)
+}
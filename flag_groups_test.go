@@ -0,0 +1,181 @@
+package cobra
+
+import (
+	"testing"
+)
+
+func TestValidateFlagGroups(t *testing.T) {
+	getCmd := func() *Command {
+		root := &Command{Use: "root", Run: emptyRun}
+		root.PersistentFlags().Bool("json", false, "")
+		root.PersistentFlags().Bool("yaml", false, "")
+		childCmd := &Command{Use: "child", Run: emptyRun}
+		childCmd.Flags().String("user", "", "")
+		childCmd.Flags().String("password", "", "")
+		root.AddCommand(childCmd)
+
+		if err := childCmd.MarkFlagsMutuallyExclusive("json", "yaml"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := childCmd.MarkFlagsRequiredTogether("user", "password"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return root
+	}
+
+	tests := []struct {
+		args        []string
+		expectedErr string
+	}{
+		{[]string{"child"}, ""},
+		{[]string{"child", "--json", "--user=u", "--password=p"}, ""},
+		{[]string{"child", "--json", "--yaml"}, "if any flags in the group [json yaml] are set none of the others can be; [json yaml] were all set"},
+		{[]string{"child", "--user=u"}, "if any flags in the group [user password] are set they must all be set; missing [password]"},
+	}
+	for _, tc := range tests {
+		_, err := executeCommand(getCmd(), tc.args...)
+		switch {
+		case tc.expectedErr == "" && err != nil:
+			t.Errorf("Unexpected error for %v: %v", tc.args, err)
+		case tc.expectedErr != "" && (err == nil || err.Error() != tc.expectedErr):
+			t.Errorf("Expected error %q for %v, got %v", tc.expectedErr, tc.args, err)
+		}
+	}
+}
+
+func TestFlagGroupsOfInheritedFlagsStayOnTheCommand(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().Bool("json", false, "output json")
+	root.PersistentFlags().Bool("yaml", false, "output yaml")
+	childCmd := &Command{Use: "child", Run: emptyRun}
+	sibCmd := &Command{Use: "sib", Run: emptyRun}
+	root.AddCommand(childCmd, sibCmd)
+
+	if err := childCmd.MarkFlagsMutuallyExclusive("json", "yaml"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, args := range [][]string{{"--json", "--yaml"}, {"sib", "--json", "--yaml"}} {
+		if _, err := executeCommand(root, args...); err != nil {
+			t.Errorf("Unexpected error for %v: %v", args, err)
+		}
+	}
+	if _, err := executeCommand(root, "child", "--json", "--yaml"); err == nil {
+		t.Error("Expected an error for mutually exclusive flags")
+	}
+
+	output, err := executeCommand(root, "sib", "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringOmits(t, output, "mutually exclusive")
+}
+
+func TestMarkFlagGroupUnknownFlag(t *testing.T) {
+	c := &Command{Use: "c", Run: emptyRun}
+	c.Flags().Bool("json", false, "")
+	if err := c.MarkFlagsMutuallyExclusive("json", "yaml"); err == nil {
+		t.Error("Expected an error for an unknown flag")
+	}
+}
+
+func TestMarkFlagRequiredIfChanged(t *testing.T) {
+	getCmd := func() *Command {
+		root := &Command{Use: "root", Run: emptyRun}
+		root.PersistentFlags().Bool("tls", false, "")
+		childCmd := &Command{Use: "child", Run: emptyRun}
+		childCmd.Flags().String("cert", "", "")
+		childCmd.Flags().Bool("mtls", false, "")
+		root.AddCommand(childCmd)
+
+		if err := childCmd.MarkFlagRequiredIfChanged("cert", "tls"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := childCmd.MarkFlagRequiredIfChanged("cert", "mtls"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return root
+	}
+
+	tests := []struct {
+		args        []string
+		expectedErr string
+	}{
+		{[]string{"child"}, ""},
+		{[]string{"child", "--cert=c"}, ""},
+		{[]string{"child", "--tls", "--cert=c"}, ""},
+		{[]string{"child", "--tls"}, `flag "cert" is required when "tls" is set`},
+		{[]string{"child", "--mtls"}, `flag "cert" is required when "mtls" is set`},
+	}
+	for _, tc := range tests {
+		_, err := executeCommand(getCmd(), tc.args...)
+		switch {
+		case tc.expectedErr == "" && err != nil:
+			t.Errorf("Unexpected error for %v: %v", tc.args, err)
+		case tc.expectedErr != "" && (err == nil || err.Error() != tc.expectedErr):
+			t.Errorf("Expected error %q for %v, got %v", tc.expectedErr, tc.args, err)
+		}
+	}
+
+	cmd := &Command{Use: "cmd", Run: emptyRun}
+	cmd.Flags().String("cert", "", "")
+	if err := cmd.MarkFlagRequiredIfChanged("cert", "unknown"); err == nil {
+		t.Error("Expected an error for an unknown flag")
+	}
+	if err := cmd.MarkFlagRequiredIfChanged("unknown", "cert"); err == nil {
+		t.Error("Expected an error for an unknown flag")
+	}
+}
+
+func TestMarkFlagRequiredIfChangedOfInheritedFlagStaysOnTheCommand(t *testing.T) {
+	getCmd := func() *Command {
+		root := &Command{Use: "root", Run: emptyRun}
+		root.PersistentFlags().Bool("tls", false, "")
+		root.PersistentFlags().String("cert", "", "")
+		childCmd := &Command{Use: "child", Run: emptyRun}
+		sibCmd := &Command{Use: "sib", Run: emptyRun}
+		root.AddCommand(childCmd, sibCmd)
+
+		if err := childCmd.MarkFlagRequiredIfChanged("cert", "tls"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return root
+	}
+
+	for _, args := range [][]string{{"--tls"}, {"sib", "--tls"}} {
+		if _, err := executeCommand(getCmd(), args...); err != nil {
+			t.Errorf("Unexpected error for %v: %v", args, err)
+		}
+	}
+	_, err := executeCommand(getCmd(), "child", "--tls")
+	if expected := `flag "cert" is required when "tls" is set`; err == nil || err.Error() != expected {
+		t.Errorf("Expected error %q, got %v", expected, err)
+	}
+}
+
+func TestFlagGroupsInHelp(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.Flags().Bool("json", false, "output json")
+	root.Flags().Bool("yaml", false, "output yaml")
+	root.Flags().Bool("xml", false, "output xml")
+	root.Flags().String("user", "", "user name")
+	root.Flags().String("password", "", "password")
+	root.Flags().Bool("verbose", false, "verbose output")
+	if err := root.MarkFlagsMutuallyExclusive("json", "yaml", "xml"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := root.MarkFlagsRequiredTogether("user", "password"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	output, err := executeCommand(root, "--help")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	checkStringContains(t, output, "output json (mutually exclusive with --yaml, --xml)\n")
+	checkStringContains(t, output, "output yaml (mutually exclusive with --json, --xml)\n")
+	checkStringContains(t, output, "output xml (mutually exclusive with --json, --yaml)\n")
+	checkStringContains(t, output, "user name (required together with --password)\n")
+	checkStringContains(t, output, "password (required together with --user)\n")
+	checkStringContains(t, output, "verbose output\n")
+}
@@ -0,0 +1,291 @@
+package cobra
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	flag "github.com/spf13/pflag"
+)
+
+// FlagEnvVarAnnotation is the flag annotation naming the environment
+// variable bound to the flag. It is documented by the doc generators.
+const FlagEnvVarAnnotation = "cobra_annotation_env_var"
+
+// requiredNonEmptyAnnotation marks the required flags which must not be set to
+// an empty value.
+const requiredNonEmptyAnnotation = "cobra_annotation_required_non_empty"
+
+// allFlags returns the flags of c, including the ones inherited from its
+// parents.
+func (c *Command) allFlags() *flag.FlagSet {
+	c.mergePersistentFlags()
+	return c.Flags()
+}
+
+// FlagChanged reports whether the flag with the given name, local to c or
+// inherited from its parents, was set on the command line.
+func (c *Command) FlagChanged(name string) bool {
+	flag := c.allFlags().Lookup(name)
+	return flag != nil && flag.Changed
+}
+
+// copyFlags adds to dst a copy of each flag of src for which keep returns
+// true, or of all of them if keep is nil. The copies share the values of the
+// original flags.
+func copyFlags(dst, src *flag.FlagSet, keep func(*flag.Flag) bool) {
+	src.VisitAll(func(f *flag.Flag) {
+		if keep != nil && !keep(f) {
+			return
+		}
+		fc := *f
+		if f.Annotations != nil {
+			fc.Annotations = make(map[string][]string, len(f.Annotations))
+			for k, v := range f.Annotations {
+				fc.Annotations[k] = copyStrings(v)
+			}
+		}
+		dst.AddFlag(&fc)
+		if comp, exists := flagCompletionFunctions[f]; exists {
+			flagCompletionFunctions[&fc] = comp
+		}
+	})
+}
+
+// visitFlagsInOrder calls fn for each flag of flags in the order of their
+// declaration, whatever the SortFlags setting of flags, so that the flag sets
+// built from it can be listed either way.
+func visitFlagsInOrder(flags *flag.FlagSet, fn func(*flag.Flag)) {
+	sorted := flags.SortFlags
+	flags.SortFlags = false
+	defer func() { flags.SortFlags = sorted }()
+	flags.VisitAll(fn)
+}
+
+// flagState is the state of a flag saved before it is first parsed.
+type flagState struct {
+	changed bool
+	// value is a copy of what the flag value points to: the variable of the
+	// flag for the basic types, and the state telling whether they were set
+	// for the slice and map values of pflag, which append to, or merge into,
+	// their variable once set.
+	value reflect.Value
+	str   string
+	slice []string
+}
+
+func saveFlagState(f *flag.Flag) *flagState {
+	state := &flagState{changed: f.Changed, str: f.Value.String()}
+	if v := reflect.ValueOf(f.Value); v.Kind() == reflect.Ptr && !v.IsNil() {
+		state.value = reflect.New(v.Elem().Type()).Elem()
+		state.value.Set(v.Elem())
+	}
+	if sv, ok := f.Value.(flag.SliceValue); ok {
+		state.slice = copyStrings(sv.GetSlice())
+	}
+	return state
+}
+
+// restore sets f back to the saved state, without validating the restored
+// value as Set does.
+func (state *flagState) restore(f *flag.Flag) error {
+	var err error
+	if state.value.IsValid() {
+		reflect.ValueOf(f.Value).Elem().Set(state.value)
+	}
+	switch v := f.Value.(type) {
+	case *enumValue:
+		*v.value = state.str
+	case flag.SliceValue:
+		err = v.Replace(copyStrings(state.slice))
+	default:
+		if strings.HasPrefix(v.Type(), "stringTo") && state.str != "[]" {
+			// the first Set replaces the whole map
+			err = v.Set(strings.Trim(state.str, "[]"))
+			reflect.ValueOf(f.Value).Elem().Set(state.value)
+		}
+	}
+	f.Changed = state.changed
+	if err != nil {
+		return fmt.Errorf("cannot reset flag %q to %q: %v", f.Name, state.str, err)
+	}
+	return nil
+}
+
+// UnknownFlags returns the unknown flags, along with the values pflag
+// consumed for them, found in the arguments of the last call to ParseFlags,
+// in order. They are only recorded when FParseErrWhitelist.UnknownFlags is
+// set, as the parsing fails otherwise.
+func (c *Command) UnknownFlags() []string {
+	return c.unknownFlags
+}
+
+// unknownFlagArgs returns the arguments which pflag skips when parsing args
+// with unknown flags whitelisted: the unknown flags and their values.
+func unknownFlagArgs(flags *flag.FlagSet, args []string) []string {
+	var unknown []string
+	for len(args) > 0 {
+		s := args[0]
+		args = args[1:]
+		if s == "--" {
+			break
+		}
+		if len(s) < 2 || s[0] != '-' {
+			continue
+		}
+
+		if s[1] == '-' {
+			name := strings.SplitN(s[2:], "=", 2)[0]
+			f := flags.Lookup(name)
+			hasValue := strings.Contains(s, "=")
+			switch {
+			case f == nil:
+				unknown = append(unknown, s)
+				if !hasValue && len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+					unknown = append(unknown, args[0])
+					args = args[1:]
+				}
+			case !hasValue && f.NoOptDefVal == "" && len(args) > 0:
+				args = args[1:]
+			}
+			continue
+		}
+
+		for shorthands := s[1:]; len(shorthands) > 0; shorthands = shorthands[1:] {
+			f := flags.ShorthandLookup(shorthands[:1])
+			hasValue := len(shorthands) > 2 && shorthands[1] == '='
+			if f == nil {
+				if hasValue {
+					unknown = append(unknown, "-"+shorthands)
+					break
+				}
+				unknown = append(unknown, "-"+shorthands[:1])
+				if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+					unknown = append(unknown, args[0])
+					args = args[1:]
+				}
+				continue
+			}
+			if f.NoOptDefVal != "" && !hasValue {
+				continue
+			}
+			// the rest of the shorthands, or the next argument, is the value
+			if len(shorthands) == 1 && len(args) > 0 {
+				args = args[1:]
+			}
+			break
+		}
+	}
+	return unknown
+}
+
+// MarkFlagHidden hides the named flag of the command from help, usage,
+// documentation, and completion. The flag can still be used.
+func (c *Command) MarkFlagHidden(name string) error {
+	return c.Flags().MarkHidden(name)
+}
+
+// MarkPersistentFlagHidden hides the named persistent flag of the command
+// from help, usage, documentation, and completion. The flag can still be used.
+func (c *Command) MarkPersistentFlagHidden(name string) error {
+	return c.PersistentFlags().MarkHidden(name)
+}
+
+// GetBool returns the value of the bool flag with the given name, looking it
+// up in the local flags of c and in the ones inherited from its parents.
+func (c *Command) GetBool(name string) (bool, error) {
+	return c.allFlags().GetBool(name)
+}
+
+// GetInt returns the value of the int flag with the given name, looking it
+// up in the local flags of c and in the ones inherited from its parents.
+func (c *Command) GetInt(name string) (int, error) {
+	return c.allFlags().GetInt(name)
+}
+
+// GetString returns the value of the string flag with the given name, looking
+// it up in the local flags of c and in the ones inherited from its parents.
+func (c *Command) GetString(name string) (string, error) {
+	return c.allFlags().GetString(name)
+}
+
+// GetStringSlice returns the value of the stringSlice flag with the given
+// name, looking it up in the local flags of c and in the ones inherited from
+// its parents.
+func (c *Command) GetStringSlice(name string) ([]string, error) {
+	return c.allFlags().GetStringSlice(name)
+}
+
+// GetStringArray returns the values of the stringArray flag with the given
+// name, looking it up in the local flags of c and in the ones inherited from
+// its parents.
+func (c *Command) GetStringArray(name string) ([]string, error) {
+	return c.allFlags().GetStringArray(name)
+}
+
+// GetDuration returns the value of the duration flag with the given name,
+// looking it up in the local flags of c and in the ones inherited from its
+// parents.
+func (c *Command) GetDuration(name string) (time.Duration, error) {
+	return c.allFlags().GetDuration(name)
+}
+
+// GetFloat64 returns the value of the float64 flag with the given name,
+// looking it up in the local flags of c and in the ones inherited from its
+// parents.
+func (c *Command) GetFloat64(name string) (float64, error) {
+	return c.allFlags().GetFloat64(name)
+}
+
+// GetIP returns the value of the ip flag with the given name, looking it up
+// in the local flags of c and in the ones inherited from its parents.
+func (c *Command) GetIP(name string) (net.IP, error) {
+	return c.allFlags().GetIP(name)
+}
+
+// enumValue is a string flag value restricted to a set of allowed values.
+type enumValue struct {
+	value   *string
+	allowed []string
+}
+
+// newEnumValue panics if the default value of the named flag is not allowed,
+// as pflag does for the other mistakes in the definition of a flag.
+func newEnumValue(name string, val string, p *string, allowed []string) *enumValue {
+	if !stringInSlice(val, allowed) {
+		panic(fmt.Sprintf("default value %q of flag %q must be one of %q", val, name, allowed))
+	}
+	*p = val
+	return &enumValue{value: p, allowed: allowed}
+}
+
+func (e *enumValue) Set(val string) error {
+	for _, a := range e.allowed {
+		if val == a {
+			*e.value = val
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of %q", e.allowed)
+}
+
+func (e *enumValue) Type() string { return "string" }
+
+func (e *enumValue) String() string { return *e.value }
+
+// EnumVar defines a string flag with the specified name, allowed values,
+// default value, and usage string. The argument p points to a string variable
+// in which to store the value of the flag. Setting the flag to a value which is
+// not allowed is a parse error, and the allowed values are offered as
+// completions by every shell. It panics if the default value is not allowed.
+func EnumVar(flags *flag.FlagSet, p *string, name string, allowed []string, value string, usage string) {
+	flags.Var(newEnumValue(name, value, p, allowed), name, usage)
+}
+
+// EnumVarP is like EnumVar, but accepts a shorthand letter that can be used
+// after a single dash.
+func EnumVarP(flags *flag.FlagSet, p *string, name, shorthand string, allowed []string, value string, usage string) {
+	flags.VarP(newEnumValue(name, value, p, allowed), name, shorthand, usage)
+}
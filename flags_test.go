@@ -0,0 +1,205 @@
+package cobra
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetFlagValues(t *testing.T) {
+	var (
+		gotBool   bool
+		gotInt    int
+		gotString string
+		gotSlice  []string
+		err       error
+	)
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().Bool("verbose", false, "")
+	root.PersistentFlags().Int("retries", 1, "")
+	root.PersistentFlags().String("name", "", "")
+	root.PersistentFlags().StringSlice("labels", nil, "")
+	childCmd := &Command{
+		Use: "child",
+		Run: func(c *Command, _ []string) {
+			if gotBool, err = c.GetBool("verbose"); err != nil {
+				return
+			}
+			if gotInt, err = c.GetInt("retries"); err != nil {
+				return
+			}
+			if gotString, err = c.GetString("name"); err != nil {
+				return
+			}
+			gotSlice, err = c.GetStringSlice("labels")
+		},
+	}
+	root.AddCommand(childCmd)
+
+	if _, err := executeCommand(root, "child", "--verbose", "--retries=3", "--name", "foo", "--labels=a,b"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error reading flags: %v", err)
+	}
+	if !gotBool || gotInt != 3 || gotString != "foo" || !reflect.DeepEqual(gotSlice, []string{"a", "b"}) {
+		t.Errorf("Unexpected flag values: %v, %v, %q, %q", gotBool, gotInt, gotString, gotSlice)
+	}
+}
+
+func TestGetTypedFlagValues(t *testing.T) {
+	var (
+		gotTimeout time.Duration
+		gotRatio   float64
+		gotIP      net.IP
+		err        error
+	)
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().Duration("timeout", time.Second, "")
+	root.PersistentFlags().Float64("ratio", 0.5, "")
+	root.PersistentFlags().IP("bind", net.IPv4(127, 0, 0, 1), "")
+	childCmd := &Command{
+		Use: "child",
+		Run: func(c *Command, _ []string) {
+			if gotTimeout, err = c.GetDuration("timeout"); err != nil {
+				return
+			}
+			if gotRatio, err = c.GetFloat64("ratio"); err != nil {
+				return
+			}
+			gotIP, err = c.GetIP("bind")
+		},
+	}
+	root.AddCommand(childCmd)
+
+	if _, err := executeCommand(root, "child", "--timeout", "1m30s", "--bind", "10.0.0.1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("Unexpected error reading flags: %v", err)
+	}
+	if gotTimeout != 90*time.Second || gotRatio != 0.5 || !gotIP.Equal(net.IPv4(10, 0, 0, 1)) {
+		t.Errorf("Unexpected flag values: %v, %v, %v", gotTimeout, gotRatio, gotIP)
+	}
+
+	if _, err := childCmd.GetDuration("ratio"); err == nil {
+		t.Error("Expected an error reading a float64 flag as a duration")
+	}
+	if _, err := childCmd.GetIP("missing"); err == nil {
+		t.Error("Expected an error reading an unknown flag")
+	}
+}
+
+func TestGetFlagValueErrors(t *testing.T) {
+	c := &Command{Use: "c", Run: emptyRun}
+	c.Flags().Int("count", 0, "")
+
+	if _, err := c.GetString("count"); err == nil {
+		t.Error("Expected an error reading an int flag as a string")
+	}
+	if _, err := c.GetBool("missing"); err == nil {
+		t.Error("Expected an error reading an unknown flag")
+	}
+}
+
+func TestEnumFlag(t *testing.T) {
+	var format string
+	root := &Command{Use: "root", Run: emptyRun}
+	EnumVar(root.Flags(), &format, "format", []string{"json", "yaml", "table"}, "table", "output format")
+
+	if format != "table" {
+		t.Errorf("Expected default value %q, got %q", "table", format)
+	}
+	if _, err := executeCommand(root, "--format", "yaml"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if format != "yaml" {
+		t.Errorf("Expected value %q, got %q", "yaml", format)
+	}
+}
+
+func TestEnumFlagInvalidDefault(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("Expected a panic for a default value which is not allowed")
+		}
+		checkStringContains(t, fmt.Sprint(r), `default value "" of flag "format" must be one of ["json" "yaml"]`)
+	}()
+	root := &Command{Use: "root", Run: emptyRun}
+	EnumVar(root.Flags(), new(string), "format", []string{"json", "yaml"}, "", "output format")
+}
+
+func TestEnumFlagInvalidValue(t *testing.T) {
+	var format string
+	root := &Command{Use: "root", Run: emptyRun}
+	EnumVarP(root.Flags(), &format, "format", "f", []string{"json", "yaml", "table"}, "table", "output format")
+
+	_, err := executeCommand(root, "-f", "xml")
+	if err == nil {
+		t.Fatal("Expected an error for a value which is not allowed")
+	}
+	expected := `invalid argument "xml" for "-f, --format" flag: must be one of ["json" "yaml" "table"]`
+	if err.Error() != expected {
+		t.Errorf("Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestFlagChanged(t *testing.T) {
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().String("config", "", "")
+	root.PersistentFlags().Bool("verbose", false, "")
+	child := &Command{Use: "child", Run: emptyRun}
+	child.Flags().Int("retries", 1, "")
+	child.Flags().String("name", "", "")
+	root.AddCommand(child)
+
+	if _, err := executeCommand(root, "child", "--config", "c.yaml", "--retries", "1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for name, expected := range map[string]bool{
+		"config":  true,
+		"retries": true,
+		"verbose": false,
+		"name":    false,
+		"unknown": false,
+	} {
+		if got := child.FlagChanged(name); got != expected {
+			t.Errorf("Expected FlagChanged(%q) to be %v, got %v", name, expected, got)
+		}
+	}
+}
+
+func TestGetRepeatedFlagValuesInRun(t *testing.T) {
+	var (
+		gotSlice, gotArray []string
+		sliceErr, arrayErr error
+	)
+	root := &Command{Use: "root", Run: emptyRun}
+	root.PersistentFlags().StringSlice("labels", nil, "")
+	root.PersistentFlags().StringArray("env", nil, "")
+	childCmd := &Command{
+		Use: "child",
+		Run: func(c *Command, _ []string) {
+			gotSlice, sliceErr = c.GetStringSlice("labels")
+			gotArray, arrayErr = c.GetStringArray("env")
+		},
+	}
+	root.AddCommand(childCmd)
+
+	if _, err := executeCommand(root, "--labels", "a,b", "child", "--labels", "c", "--env", "A=1,2", "--env", "B=3"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if sliceErr != nil || arrayErr != nil {
+		t.Fatalf("Unexpected errors: %v, %v", sliceErr, arrayErr)
+	}
+	if expected := []string{"a", "b", "c"}; !reflect.DeepEqual(gotSlice, expected) {
+		t.Errorf("Expected %v, got %v", expected, gotSlice)
+	}
+	if expected := []string{"A=1,2", "B=3"}; !reflect.DeepEqual(gotArray, expected) {
+		t.Errorf("Expected %v, got %v", expected, gotArray)
+	}
+}
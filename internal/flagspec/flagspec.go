@@ -0,0 +1,29 @@
+// Package flagspec describes how the values of the flags are given on the
+// command line, for the help, completion and documentation of cobra.
+package flagspec
+
+import (
+	"strconv"
+
+	"github.com/spf13/pflag"
+)
+
+// ValueSpec reports whether f requires a value on the command line and the
+// placeholder naming that value, as shown in the help: the name quoted in
+// backticks in the usage, or else the type of the value. The flags with a
+// NoOptDefVal, such as bool flags, take an optional value: their placeholder
+// is their default value, quoted for string flags. Count flags take no value
+// and can be repeated: their placeholder is empty.
+func ValueSpec(f *pflag.Flag) (takesArg bool, placeholder string) {
+	if f.NoOptDefVal != "" {
+		switch f.Value.Type() {
+		case "count":
+			return false, ""
+		case "string":
+			return false, strconv.Quote(f.DefValue)
+		}
+		return false, f.DefValue
+	}
+	placeholder, _ = pflag.UnquoteUsage(f)
+	return true, placeholder
+}
@@ -0,0 +1,39 @@
+package flagspec
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestValueSpec(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Bool("bool", false, "")
+	flags.String("string", "", "")
+	flags.String("file", "", "read the `path`")
+	flags.String("color", "auto", "")
+	flags.Lookup("color").NoOptDefVal = "always"
+	flags.Int("int", 0, "")
+	flags.CountP("count", "v", "")
+	flags.StringSlice("slice", nil, "")
+
+	tests := []struct {
+		name        string
+		takesArg    bool
+		placeholder string
+	}{
+		{"bool", false, "false"},
+		{"string", true, "string"},
+		{"file", true, "path"},
+		{"color", false, `"auto"`},
+		{"int", true, "int"},
+		{"count", false, ""},
+		{"slice", true, "strings"},
+	}
+	for _, tc := range tests {
+		takesArg, placeholder := ValueSpec(flags.Lookup(tc.name))
+		if takesArg != tc.takesArg || placeholder != tc.placeholder {
+			t.Errorf("%s: expected (%v, %q), got (%v, %q)", tc.name, tc.takesArg, tc.placeholder, takesArg, placeholder)
+		}
+	}
+}
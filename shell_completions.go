@@ -25,8 +25,26 @@ func MarkFlagRequired(flags *pflag.FlagSet, name string) error {
 	return flags.SetAnnotation(name, BashCompOneRequiredFlag, []string{"true"})
 }
 
+// MarkFlagRequiredNonEmpty is like MarkFlagRequired, but the command also
+// reports an error if the named flag is set to an empty value, as with
+// --name=.
+func (c *Command) MarkFlagRequiredNonEmpty(name string) error {
+	return MarkFlagRequiredNonEmpty(c.Flags(), name)
+}
+
+// MarkFlagRequiredNonEmpty is like MarkFlagRequired, but the command also
+// reports an error if the named flag is set to an empty value, as with
+// --name=.
+func MarkFlagRequiredNonEmpty(flags *pflag.FlagSet, name string) error {
+	if err := MarkFlagRequired(flags, name); err != nil {
+		return err
+	}
+	return flags.SetAnnotation(name, requiredNonEmptyAnnotation, []string{"true"})
+}
+
 // MarkFlagFilename instructs the various shell completion implementations to
 // limit completions for the named flag to the specified file extensions.
+// Without extensions, any file is completed.
 func (c *Command) MarkFlagFilename(name string, extensions ...string) error {
 	return MarkFlagFilename(c.Flags(), name, extensions...)
 }
@@ -43,13 +61,14 @@ func (c *Command) MarkFlagCustom(name string, f string) error {
 
 // MarkPersistentFlagFilename instructs the various shell completion
 // implementations to limit completions for the named persistent flag to the
-// specified file extensions.
+// specified file extensions. Without extensions, any file is completed.
 func (c *Command) MarkPersistentFlagFilename(name string, extensions ...string) error {
 	return MarkFlagFilename(c.PersistentFlags(), name, extensions...)
 }
 
 // MarkFlagFilename instructs the various shell completion implementations to
 // limit completions for the named flag to the specified file extensions.
+// Without extensions, any file is completed.
 func MarkFlagFilename(flags *pflag.FlagSet, name string, extensions ...string) error {
 	return flags.SetAnnotation(name, BashCompFilenameExt, extensions)
 }
@@ -82,3 +101,15 @@ func (c *Command) MarkPersistentFlagDirname(name string) error {
 func MarkFlagDirname(flags *pflag.FlagSet, name string) error {
 	return flags.SetAnnotation(name, BashCompSubdirsInDir, []string{})
 }
+
+// SetFlagAnnotation sets the annotation key of the named flag, local or
+// persistent, to values. The well-known keys BashCompFilenameExt,
+// BashCompSubdirsInDir, BashCompCustom and BashCompValidValues are used by the
+// shell completion implementations.
+func (c *Command) SetFlagAnnotation(name, key string, values []string) error {
+	flags := c.Flags()
+	if flags.Lookup(name) == nil {
+		flags = c.PersistentFlags()
+	}
+	return flags.SetAnnotation(name, key, values)
+}
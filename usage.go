@@ -0,0 +1,66 @@
+package cobra
+
+import (
+	flag "github.com/spf13/pflag"
+)
+
+// UsageInfo is the usage of a command as data, for the programs which render
+// it themselves.
+type UsageInfo struct {
+	UseLine        string
+	Aliases        []string
+	LocalFlags     []FlagInfo
+	InheritedFlags []FlagInfo
+	Commands       []CommandInfo
+	Example        string
+}
+
+// FlagInfo describes a flag in a UsageInfo.
+type FlagInfo struct {
+	Name      string
+	Shorthand string
+	Usage     string
+	Default   string
+	Type      string
+}
+
+// CommandInfo describes a sub command in a UsageInfo.
+type CommandInfo struct {
+	Name  string
+	Short string
+}
+
+// UsageInfo returns the usage of c as data. It holds what the default usage
+// template shows: hidden flags and unavailable sub commands are left out.
+func (c *Command) UsageInfo() UsageInfo {
+	info := UsageInfo{
+		UseLine:        c.UseLine(),
+		Aliases:        copyStrings(c.Aliases),
+		LocalFlags:     flagInfos(c.LocalFlags()),
+		InheritedFlags: flagInfos(c.InheritedFlags()),
+		Example:        c.RenderedExample(),
+	}
+	for _, sub := range c.Commands() {
+		if sub.IsAvailableCommand() || sub.Name() == "help" {
+			info.Commands = append(info.Commands, CommandInfo{Name: sub.Name(), Short: sub.Short})
+		}
+	}
+	return info
+}
+
+func flagInfos(flags *flag.FlagSet) []FlagInfo {
+	var infos []FlagInfo
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Hidden {
+			return
+		}
+		infos = append(infos, FlagInfo{
+			Name:      f.Name,
+			Shorthand: f.Shorthand,
+			Usage:     f.Usage,
+			Default:   f.DefValue,
+			Type:      f.Value.Type(),
+		})
+	})
+	return infos
+}
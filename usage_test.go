@@ -0,0 +1,41 @@
+package cobra
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUsageInfo(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose output")
+	childCmd := &Command{
+		Use:     "child [name]",
+		Aliases: []string{"kid"},
+		Example: "  root child foo",
+		Run:     emptyRun,
+	}
+	childCmd.Flags().Int("count", 3, "number of items")
+	childCmd.Flags().String("secret", "", "")
+	childCmd.Flags().MarkHidden("secret")
+	childCmd.AddCommand(
+		&Command{Use: "grandchild", Short: "A grandchild", Run: emptyRun},
+		&Command{Use: "hidden", Hidden: true, Run: emptyRun},
+	)
+	rootCmd.AddCommand(childCmd)
+
+	expected := UsageInfo{
+		UseLine: "root child [name] [flags]",
+		Aliases: []string{"kid"},
+		LocalFlags: []FlagInfo{
+			{Name: "count", Usage: "number of items", Default: "3", Type: "int"},
+		},
+		InheritedFlags: []FlagInfo{
+			{Name: "verbose", Shorthand: "v", Usage: "verbose output", Default: "false", Type: "bool"},
+		},
+		Commands: []CommandInfo{{Name: "grandchild", Short: "A grandchild"}},
+		Example:  "  root child foo",
+	}
+	if got := childCmd.UsageInfo(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected:\n%+v\nGot:\n%+v", expected, got)
+	}
+}
@@ -1,7 +1,7 @@
 package cobra
 
 import (
-	"bytes"
+	"bufio"
 	"fmt"
 	"io"
 	"os"
@@ -64,13 +64,12 @@ func (c *Command) genZshCompletionFile(filename string, includeDesc bool) error
 }
 
 func (c *Command) genZshCompletion(w io.Writer, includeDesc bool) error {
-	buf := new(bytes.Buffer)
+	buf := bufio.NewWriter(w)
 	genZshComp(buf, c.Name(), includeDesc)
-	_, err := buf.WriteTo(w)
-	return err
+	return buf.Flush()
 }
 
-func genZshComp(buf *bytes.Buffer, name string, includeDesc bool) {
+func genZshComp(buf io.StringWriter, name string, includeDesc bool) {
 	compCmd := ShellCompRequestCmd
 	if !includeDesc {
 		compCmd = ShellCompNoDescRequestCmd
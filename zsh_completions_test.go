@@ -0,0 +1,114 @@
+package cobra
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestZshCompletionFileFilter(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	rootCmd.Flags().String("config", "", "config file")
+	if err := rootCmd.MarkFlagFilename("config"); err != nil {
+		t.Fatal(err)
+	}
+	rootCmd.Flags().String("manifest", "", "manifest file")
+	if err := rootCmd.MarkFlagFilename("manifest", "yaml", "yml"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without extensions any file is completed, with plain _files
+	output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, "--config", "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	check(t, output, "Completion ended with directive: ShellCompDirectiveDefault")
+
+	// Extensions are turned into glob filters
+	output, err = executeCommand(rootCmd, ShellCompNoDescRequestCmd, "--manifest", "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	expected := strings.Join([]string{
+		"yaml", "yml",
+		":8",
+		"Completion ended with directive: ShellCompDirectiveFilterFileExt", ""}, "\n")
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := rootCmd.GenZshCompletion(buf); err != nil {
+		t.Fatal(err)
+	}
+	script := buf.String()
+	check(t, script, `_arguments '*:filename:_files'" ${flagPrefix}"`)
+	check(t, script, `filter="\*.$filter"`)
+	check(t, script, `filteringCmd+=" -g $filter"`)
+}
+
+func TestZshCompletionValuelessFlags(t *testing.T) {
+	rootCmd := &Command{Use: "root", ValidArgs: []string{"one", "two"}, Run: emptyRun}
+	rootCmd.Flags().Bool("debug", false, "debug mode")
+	rootCmd.Flags().String("color", "", "colorize output")
+	rootCmd.Flags().Lookup("color").NoOptDefVal = "auto"
+	rootCmd.Flags().String("name", "", "name")
+	if err := rootCmd.RegisterFlagCompletionFunc("name", func(cmd *Command, args []string, toComplete string) ([]string, ShellCompDirective) {
+		return []string{"alice", "bob"}, ShellCompDirectiveNoFileComp
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flags without a required value are not followed by a value to
+	// complete, so the next word is completed as usual.
+	for _, flagName := range []string{"--debug", "--color"} {
+		output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, flagName, "")
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		check(t, output, "one\ntwo\n")
+		checkOmit(t, output, "alice")
+	}
+
+	output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, "--name", "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	expected := strings.Join([]string{
+		"alice", "bob",
+		":4",
+		"Completion ended with directive: ShellCompDirectiveNoFileComp", ""}, "\n")
+	if output != expected {
+		t.Errorf("expected: %q, got: %q", expected, output)
+	}
+}
+
+func TestMarkFlagDirnameInGeneratedScripts(t *testing.T) {
+	rootCmd := &Command{Use: "root", Run: emptyRun}
+	rootCmd.Flags().String("output-dir", "", "output directory")
+	if err := rootCmd.MarkFlagDirname("output-dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rootCmd.MarkFlagDirname("missing"); err == nil {
+		t.Error("Expected an error marking a flag which does not exist")
+	}
+
+	// zsh gets a directive from __complete which it turns into _files -/
+	output, err := executeCommand(rootCmd, ShellCompNoDescRequestCmd, "--output-dir", "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	check(t, output, "Completion ended with directive: ShellCompDirectiveFilterDirs\n")
+
+	buf := new(bytes.Buffer)
+	if err := rootCmd.GenZshCompletion(buf); err != nil {
+		t.Fatal(err)
+	}
+	check(t, buf.String(), `_arguments '*:dirname:_files -/'" ${flagPrefix}"`)
+
+	buf.Reset()
+	if err := rootCmd.GenBashCompletion(buf); err != nil {
+		t.Fatal(err)
+	}
+	check(t, buf.String(), `flags_completion+=("_filedir -d")`)
+}